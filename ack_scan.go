@@ -0,0 +1,329 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRecordNacked is returned by ScanAck when a record is rejected with a nil
+// error passed to Nack.
+var ErrRecordNacked = errors.New("record nacked")
+
+// ScanAckOption customizes ScanAck.
+type ScanAckOption func(*scanAckConfig)
+
+type scanAckConfig struct {
+	maxUnacked int
+}
+
+// WithMaxUnackedRecords caps the number of records per shard that have been
+// handed to the callback but not yet acknowledged. Once the cap is reached the
+// shard stops delivering records until earlier ones are acknowledged.
+func WithMaxUnackedRecords(n int) ScanAckOption {
+	return func(cfg *scanAckConfig) {
+		cfg.maxUnacked = n
+	}
+}
+
+// Ack marks a record delivered by ScanAck as processed. The shard checkpoint
+// advances once every earlier record on the shard has been acknowledged.
+// Ack is a no-op for records delivered by other scan methods and for records
+// that were already acknowledged.
+func (r *Record) Ack() {
+	if r.ack != nil {
+		r.ack.done(nil)
+	}
+}
+
+// Nack rejects a record delivered by ScanAck. Scanning stops and ScanAck
+// returns err; the checkpoint stays before the rejected record.
+func (r *Record) Nack(err error) {
+	if r.ack == nil {
+		return
+	}
+	if err == nil {
+		err = ErrRecordNacked
+	}
+	r.ack.done(err)
+}
+
+// ScanAck scans all shards and hands each record to fn, which is expected to
+// pass it on to an asynchronous pipeline and return. The record is considered
+// in flight until Record.Ack or Record.Nack is called, and each shard is
+// checkpointed at the end of its contiguous acknowledged prefix.
+//
+// Returning an error from fn stops scanning, as with Scan. Returning
+// ErrSkipCheckpoint acknowledges the record without checkpointing at it.
+// With WithDeadLetter, a record handed to the sink is acknowledged.
+// Acknowledgements that arrive after ScanAck returns are ignored.
+func (c *Consumer) ScanAck(ctx context.Context, fn ScanFunc, opts ...ScanAckOption) error {
+	if fn == nil {
+		return errors.New("ack callback is required")
+	}
+	if c.partitionKeyConcurrency > 1 {
+		return errors.New("partition key concurrency is not supported with ScanAck")
+	}
+
+	cfg := scanAckConfig{
+		maxUnacked: 1000,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.maxUnacked <= 0 {
+		cfg.maxUnacked = 1000
+	}
+
+	runner := newScanAckRunner(c, fn, cfg)
+	return runner.run(ctx)
+}
+
+type scanAckRunner struct {
+	consumer *Consumer
+	fn       ScanFunc
+	cfg      scanAckConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// ackMu is held for reading while an acknowledgement is applied, so
+	// closing waits for in-progress checkpoints.
+	ackMu  sync.RWMutex
+	closed bool
+
+	trackersMu sync.Mutex
+	trackers   map[string]*ackTracker
+
+	asyncErrMu sync.Mutex
+	asyncErr   error
+}
+
+func newScanAckRunner(consumer *Consumer, fn ScanFunc, cfg scanAckConfig) *scanAckRunner {
+	return &scanAckRunner{
+		consumer: consumer,
+		fn:       fn,
+		cfg:      cfg,
+		trackers: make(map[string]*ackTracker),
+	}
+}
+
+func (r *scanAckRunner) run(ctx context.Context) error {
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	defer r.cancel()
+	scanID, ok := r.consumer.shutdown.startScan(r.cancel)
+	if !ok {
+		return nil
+	}
+	defer r.consumer.shutdown.endScan(scanID)
+	scanErr := r.consumer.scan(r.ctx, func(ctx context.Context) ScanFunc {
+		r.fn = r.consumer.deadLetterScanFunc(ctx, r.fn)
+		return r.handle
+	}, shardHooks{beforeClose: r.beforeClose})
+
+	// stop accepting acknowledgements before the final flush
+	r.ackMu.Lock()
+	r.closed = true
+	r.ackMu.Unlock()
+	r.abandonPending()
+
+	if err := r.getAsyncErr(); err != nil {
+		return err
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+	if err := r.consumer.flushCheckpoints(); err != nil {
+		return fmt.Errorf("checkpoint flush error: %w", err)
+	}
+	return nil
+}
+
+func (r *scanAckRunner) handle(record *Record) error {
+	tracker := r.tracker(record.ShardID)
+
+	select {
+	case <-r.ctx.Done():
+		// the scan is stopping; leave the record undelivered
+		return ErrSkipCheckpoint
+	case tracker.slots <- struct{}{}:
+	}
+
+	record.ack = tracker.add(record.checkpoint)
+	// the record keeps its share of the page's memory until acknowledged
+	record.ack.retained = record.memory.retain(recordSize(record))
+	err := r.fn(record)
+	switch {
+	case errors.Is(err, ErrSkipCheckpoint):
+		record.ack.skip()
+	case err != nil:
+		return err
+	case record.deadLettered:
+		// the callback failed, so nothing else acknowledges the record
+		record.ack.done(nil)
+	}
+	return ErrSkipCheckpoint
+}
+
+// beforeClose drains a shard that ended or is handed back, unless its lease
+// was lost and its records can no longer be checkpointed.
+func (r *scanAckRunner) beforeClose(ctx context.Context, shardID string, stop shardStop) error {
+	if stop != shardLeaseLost {
+		r.drain(ctx, shardID)
+	}
+	return nil
+}
+
+// drain waits until every record of a fully read shard is acknowledged, so
+// child shards are not released before their parent is checkpointed.
+func (r *scanAckRunner) drain(ctx context.Context, shardID string) {
+	tracker := r.tracker(shardID)
+	for i := 0; i < cap(tracker.slots); i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case tracker.slots <- struct{}{}:
+		}
+	}
+	for i := 0; i < cap(tracker.slots); i++ {
+		<-tracker.slots
+	}
+}
+
+// abandonPending gives up the records still in flight once the scan has
+// stopped, so their memory goes back to the budget. Acknowledging them later
+// is a no-op.
+func (r *scanAckRunner) abandonPending() {
+	r.trackersMu.Lock()
+	defer r.trackersMu.Unlock()
+
+	for _, tracker := range r.trackers {
+		tracker.mu.Lock()
+		pending := tracker.pending
+		tracker.pending = nil
+		tracker.mu.Unlock()
+
+		for _, ack := range pending {
+			ack.skip()
+		}
+	}
+}
+
+func (r *scanAckRunner) tracker(shardID string) *ackTracker {
+	r.trackersMu.Lock()
+	defer r.trackersMu.Unlock()
+
+	tracker, ok := r.trackers[shardID]
+	if !ok {
+		tracker = &ackTracker{
+			runner:  r,
+			shardID: shardID,
+			slots:   make(chan struct{}, r.cfg.maxUnacked),
+		}
+		r.trackers[shardID] = tracker
+	}
+	return tracker
+}
+
+func (r *scanAckRunner) setAsyncErr(err error) {
+	r.asyncErrMu.Lock()
+	if r.asyncErr == nil {
+		r.asyncErr = err
+	}
+	r.asyncErrMu.Unlock()
+	r.cancel()
+}
+
+func (r *scanAckRunner) getAsyncErr() error {
+	r.asyncErrMu.Lock()
+	defer r.asyncErrMu.Unlock()
+
+	return r.asyncErr
+}
+
+// ackTracker keeps the outstanding records of a shard in delivery order.
+type ackTracker struct {
+	runner  *scanAckRunner
+	shardID string
+	slots   chan struct{}
+
+	mu      sync.Mutex
+	pending []*recordAck
+}
+
+func (t *ackTracker) add(sequenceNumber string) *recordAck {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ack := &recordAck{tracker: t, sequenceNumber: sequenceNumber}
+	t.pending = append(t.pending, ack)
+	return ack
+}
+
+// advance checkpoints the end of the acknowledged prefix. It must be called
+// with t.mu held.
+func (t *ackTracker) advance() error {
+	checkpointSeqNum := ""
+	n := 0
+	for ; n < len(t.pending) && t.pending[n].acked; n++ {
+		if !t.pending[n].skipped {
+			checkpointSeqNum = t.pending[n].sequenceNumber
+		}
+	}
+	t.pending = t.pending[n:]
+
+	if checkpointSeqNum == "" {
+		return nil
+	}
+	return t.runner.consumer.setCheckpointWithRetry(t.runner.ctx, t.shardID, checkpointSeqNum)
+}
+
+// recordAck is the acknowledgement handle attached to a Record by ScanAck.
+type recordAck struct {
+	tracker        *ackTracker
+	sequenceNumber string
+	// retained is the memory taken from the record's page.
+	retained int64
+	once     sync.Once
+
+	// guarded by tracker.mu
+	acked   bool
+	skipped bool
+}
+
+func (a *recordAck) skip() {
+	a.once.Do(func() { a.complete(true, nil) })
+}
+
+func (a *recordAck) done(err error) {
+	a.once.Do(func() { a.complete(false, err) })
+}
+
+func (a *recordAck) complete(skipped bool, err error) {
+	t := a.tracker
+	defer func() {
+		t.runner.consumer.memory.release(a.retained)
+		<-t.slots
+	}()
+
+	t.runner.ackMu.RLock()
+	defer t.runner.ackMu.RUnlock()
+	if t.runner.closed {
+		return
+	}
+	if err != nil {
+		t.runner.setAsyncErr(fmt.Errorf("shard %s record %s nacked: %w", t.shardID, a.sequenceNumber, err))
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a.acked = true
+	a.skipped = skipped
+	t.runner.consumer.counter.Add("records", 1)
+	if err := t.advance(); err != nil {
+		t.runner.setAsyncErr(err)
+	}
+}
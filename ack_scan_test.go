@@ -0,0 +1,128 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func newSingleShardClient() *kinesisClientMock {
+	return &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			return &kinesis.GetRecordsOutput{Records: records}, nil
+		},
+		listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+			return &kinesis.ListShardsOutput{Shards: []types.Shard{{ShardId: aws.String("myShard")}}}, nil
+		},
+	}
+}
+
+func TestScanAck_CheckpointsContiguousAckedPrefix(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithStore(cp))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	delivered := make(chan *Record, len(records))
+	errC := make(chan error, 1)
+	go func() {
+		errC <- c.ScanAck(ctx, func(r *Record) error {
+			delivered <- r
+			return nil
+		})
+	}()
+
+	first, last := <-delivered, <-delivered
+
+	last.Ack()
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "" {
+		t.Fatalf("checkpoint = %q before first record was acked", val)
+	}
+
+	first.Ack()
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want %q", val, "lastSeqNum")
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("scan ack error: %v", err)
+	}
+}
+
+func TestScanAck_NackStopsScan(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithStore(cp))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	nackErr := errors.New("downstream rejected")
+	err = c.ScanAck(context.Background(), func(r *Record) error {
+		if string(r.Data) == "firstData" {
+			r.Ack()
+		} else {
+			go r.Nack(nackErr)
+		}
+		return nil
+	})
+	if !errors.Is(err, nackErr) {
+		t.Fatalf("scan ack error = %v, want %v", err, nackErr)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "firstSeqNum" {
+		t.Fatalf("checkpoint = %q, want %q", val, "firstSeqNum")
+	}
+}
+
+func TestScanAck_MaxUnackedRecordsAppliesBackpressure(t *testing.T) {
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithStore(store.New()))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	delivered := make(chan *Record, len(records))
+	errC := make(chan error, 1)
+	go func() {
+		errC <- c.ScanAck(ctx, func(r *Record) error {
+			delivered <- r
+			return nil
+		}, WithMaxUnackedRecords(1))
+	}()
+
+	first := <-delivered
+	select {
+	case r := <-delivered:
+		t.Fatalf("record %s delivered while the unacked cap was reached", r.Data)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	first.Ack()
+	select {
+	case r := <-delivered:
+		r.Ack()
+	case <-time.After(time.Second):
+		t.Fatal("second record was not delivered after ack")
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("scan ack error: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	rec "github.com/awslabs/kinesis-aggregation/go/v2/records"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// subSequenceSeparator joins the sequence number of an aggregated Kinesis
+// record and the sub-sequence number of a user record inside it in a stored
+// checkpoint, e.g. "49590338271490256608559692538361571095921575989136588898:3".
+const subSequenceSeparator = ":"
+
+// shardRecord is a record of a normalized page together with its position
+// within its KPL aggregate and the checkpoint to store once it is processed.
+type shardRecord struct {
+	types.Record
+	subSequenceNumber int64
+	checkpoint        string
+}
+
+// shardRecords positions a normalized page of records. Deaggregated user
+// records share the sequence number of their aggregate, so a record is
+// checkpointed with its sub-sequence number unless it completes the aggregate.
+// Records at or before lastSeqNum, left over when a shard is re-read from
+// within an aggregate, are dropped.
+func (c *Consumer) shardRecords(records []types.Record, lastSeqNum string) []shardRecord {
+	out := make([]shardRecord, 0, len(records))
+	resumeSeqNum, resumeSubSeqNum, resumeWithin := parseCheckpoint(lastSeqNum)
+
+	var subSeqNum int64
+	for i, record := range records {
+		seqNum := aws.ToString(record.SequenceNumber)
+		if i > 0 && seqNum == aws.ToString(records[i-1].SequenceNumber) {
+			subSeqNum++
+		} else {
+			subSeqNum = 0
+		}
+
+		checkpoint := seqNum
+		last := i == len(records)-1 || seqNum != aws.ToString(records[i+1].SequenceNumber)
+		if c.isAggregated && !last {
+			checkpoint = formatCheckpoint(seqNum, subSeqNum)
+		}
+
+		if resumeWithin && seqNum == resumeSeqNum && subSeqNum <= resumeSubSeqNum {
+			continue
+		}
+		out = append(out, shardRecord{Record: record, subSequenceNumber: subSeqNum, checkpoint: checkpoint})
+	}
+	return out
+}
+
+func formatCheckpoint(sequenceNumber string, subSequenceNumber int64) string {
+	return sequenceNumber + subSequenceSeparator + strconv.FormatInt(subSequenceNumber, 10)
+}
+
+// parseCheckpoint splits a stored checkpoint. ok is false for a plain sequence
+// number, which marks a fully processed Kinesis record.
+func parseCheckpoint(checkpoint string) (sequenceNumber string, subSequenceNumber int64, ok bool) {
+	seqNum, sub, found := strings.Cut(checkpoint, subSequenceSeparator)
+	if !found {
+		return checkpoint, 0, false
+	}
+	n, err := strconv.ParseInt(sub, 10, 64)
+	if err != nil {
+		return checkpoint, 0, false
+	}
+	return seqNum, n, true
+}
+
+// kplMagicNumber prefixes the data of a KPL aggregated record.
+var kplMagicNumber = []byte{0xf3, 0x89, 0x9a, 0xc2}
+
+// MalformedRecordAction is what the consumer does with a record that could not
+// be deaggregated or decoded.
+type MalformedRecordAction int
+
+const (
+	// MalformedRecordFail stops the scan with the error.
+	MalformedRecordFail MalformedRecordAction = iota
+	// MalformedRecordSkip drops the record and continues.
+	MalformedRecordSkip
+	// MalformedRecordDeadLetter hands the record to the WithDeadLetter sink
+	// and continues. The scan stops if no sink is configured.
+	MalformedRecordDeadLetter
+)
+
+// MalformedRecordHandler is called with the raw Kinesis record that failed to
+// deaggregate or decode and the error. Malformed records are counted as
+// "malformed_records" on the Counter whatever the action.
+type MalformedRecordHandler func(r *Record, err error) MalformedRecordAction
+
+// normalizeRecords deaggregates a page of records when aggregation is enabled
+// and then decodes their payloads when payload codecs are configured. Each
+// Kinesis record is handled on its own so a malformed one is dealt with
+// without losing the rest of the page.
+func (c *Consumer) normalizeRecords(ctx context.Context, shardID string, records []types.Record) ([]types.Record, error) {
+	if !c.isAggregated && c.payloadCodecs == nil {
+		return records, nil
+	}
+
+	out := make([]types.Record, 0, len(records))
+	for _, record := range records {
+		userRecords, err := c.normalizeRecord(record)
+		if err == nil {
+			out = append(out, userRecords...)
+			continue
+		}
+		if err := c.handleMalformedRecord(ctx, shardID, record, err); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (c *Consumer) normalizeRecord(record types.Record) ([]types.Record, error) {
+	userRecords := []types.Record{record}
+	if c.isAggregated {
+		var err error
+		if userRecords, err = deaggregateRecord(record); err != nil {
+			return nil, err
+		}
+	}
+	if c.payloadCodecs == nil {
+		return userRecords, nil
+	}
+
+	for i := range userRecords {
+		data, err := decodePayload(c.payloadCodecs, userRecords[i].Data)
+		if err != nil {
+			if len(userRecords) > 1 {
+				err = fmt.Errorf("user record %d: %w", i, err)
+			}
+			return nil, err
+		}
+		userRecords[i].Data = data
+	}
+	return userRecords, nil
+}
+
+func (c *Consumer) handleMalformedRecord(ctx context.Context, shardID string, record types.Record, err error) error {
+	seqNum := aws.ToString(record.SequenceNumber)
+	c.logger.Log("[CONSUMER] malformed record:", shardID, seqNum, err)
+	c.counter.Add("malformed_records", 1)
+
+	r := c.newRecord(shardID, shardRecord{Record: record, checkpoint: seqNum}, nil)
+	action := MalformedRecordFail
+	if c.malformedRecordHandler != nil {
+		action = c.malformedRecordHandler(r, err)
+	}
+
+	switch action {
+	case MalformedRecordSkip:
+		return nil
+	case MalformedRecordDeadLetter:
+		if c.deadLetter == nil {
+			return fmt.Errorf("malformed record %s: no dead letter sink: %w", seqNum, err)
+		}
+		if sinkErr := c.deadLetter.sink.Put(ctx, DeadLetter{Record: r, Err: err}); sinkErr != nil {
+			return fmt.Errorf("dead letter error: %w", errors.Join(sinkErr, err))
+		}
+		c.counter.Add("dead_letters", 1)
+		return nil
+	default:
+		return fmt.Errorf("malformed record %s: %w", seqNum, err)
+	}
+}
+
+// deaggregateRecord expands a KPL aggregated record into its user records.
+// Records without the KPL magic number or whose checksum does not match are
+// not aggregates and are returned as they are.
+func deaggregateRecord(record types.Record) ([]types.Record, error) {
+	data := record.Data
+	if len(data) <= len(kplMagicNumber)+md5.Size || !bytes.HasPrefix(data, kplMagicNumber) {
+		return []types.Record{record}, nil
+	}
+
+	body := data[len(kplMagicNumber) : len(data)-md5.Size]
+	if sum := md5.Sum(body); !bytes.Equal(sum[:], data[len(data)-md5.Size:]) {
+		return []types.Record{record}, nil
+	}
+
+	// the generated records package predates the current protobuf API
+	agg := &rec.AggregatedRecord{}
+	if err := proto.Unmarshal(body, protoadapt.MessageV2Of(agg)); err != nil {
+		return nil, fmt.Errorf("unmarshal aggregated record: %w", err)
+	}
+
+	out := make([]types.Record, 0, len(agg.Records))
+	for i, userRecord := range agg.Records {
+		idx := userRecord.GetPartitionKeyIndex()
+		if idx >= uint64(len(agg.PartitionKeyTable)) {
+			return nil, fmt.Errorf("user record %d: partition key index %d out of range", i, idx)
+		}
+		out = append(out, types.Record{
+			ApproximateArrivalTimestamp: record.ApproximateArrivalTimestamp,
+			Data:                        userRecord.Data,
+			EncryptionType:              record.EncryptionType,
+			PartitionKey:                aws.String(agg.PartitionKeyTable[idx]),
+			SequenceNumber:              record.SequenceNumber,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package consumer
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	rec "github.com/awslabs/kinesis-aggregation/go/v2/records"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+func kplRecord(t *testing.T, seqNum string, agg *rec.AggregatedRecord) types.Record {
+	t.Helper()
+	body, err := proto.Marshal(protoadapt.MessageV2Of(agg))
+	if err != nil {
+		t.Fatalf("marshal aggregated record: %v", err)
+	}
+	sum := md5.Sum(body)
+	data := append(append(append([]byte{}, kplMagicNumber...), body...), sum[:]...)
+	return types.Record{SequenceNumber: aws.String(seqNum), Data: data}
+}
+
+func TestDeaggregateRecord(t *testing.T) {
+	agg := kplRecord(t, "agg", &rec.AggregatedRecord{
+		PartitionKeyTable: []string{"a", "b"},
+		Records: []*rec.Record{
+			{PartitionKeyIndex: proto.Uint64(0), Data: []byte("one")},
+			{PartitionKeyIndex: proto.Uint64(1), Data: []byte("two")},
+		},
+	})
+
+	got, err := deaggregateRecord(agg)
+	if err != nil {
+		t.Fatalf("deaggregate error: %v", err)
+	}
+	if len(got) != 2 || string(got[1].Data) != "two" || aws.ToString(got[1].PartitionKey) != "b" || aws.ToString(got[1].SequenceNumber) != "agg" {
+		t.Fatalf("deaggregated records = %+v", got)
+	}
+
+	badChecksum := agg
+	badChecksum.Data = append([]byte{}, agg.Data...)
+	badChecksum.Data[len(badChecksum.Data)-1] ^= 0xff
+	if got, err := deaggregateRecord(badChecksum); err != nil || len(got) != 1 || &got[0].Data[0] != &badChecksum.Data[0] {
+		t.Fatalf("record failing checksum = %v, %v; want passed through raw", got, err)
+	}
+}
+
+func TestNormalizeRecords_MalformedRecordHandler(t *testing.T) {
+	good := types.Record{SequenceNumber: aws.String("seq-1"), Data: []byte("plain")}
+	malformed := kplRecord(t, "seq-2", &rec.AggregatedRecord{
+		Records: []*rec.Record{{PartitionKeyIndex: proto.Uint64(3), Data: []byte("orphan")}},
+	})
+
+	t.Run("fail by default", func(t *testing.T) {
+		ctr := &fakeCounter{}
+		c := &Consumer{isAggregated: true, counter: ctr, logger: &testLogger{t}}
+		if _, err := c.normalizeRecords(context.Background(), "myShard", []types.Record{good, malformed}); err == nil {
+			t.Fatal("expected malformed record error")
+		}
+		if ctr.Get() != 1 {
+			t.Fatalf("malformed records counted = %d, want 1", ctr.Get())
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		var handled string
+		c := &Consumer{isAggregated: true, counter: &fakeCounter{}, logger: &testLogger{t}}
+		c.malformedRecordHandler = func(r *Record, err error) MalformedRecordAction {
+			handled = aws.ToString(r.SequenceNumber)
+			return MalformedRecordSkip
+		}
+		got, err := c.normalizeRecords(context.Background(), "myShard", []types.Record{malformed, good})
+		if err != nil {
+			t.Fatalf("normalize error: %v", err)
+		}
+		if handled != "seq-2" || len(got) != 1 || string(got[0].Data) != "plain" {
+			t.Fatalf("handled %q, records %+v; want seq-2 skipped", handled, got)
+		}
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		sink := &deadLetterSinkMock{}
+		c := &Consumer{isAggregated: true, counter: &fakeCounter{}, logger: &testLogger{t}}
+		WithDeadLetter(sink)(c)
+		WithMalformedRecordHandler(func(*Record, error) MalformedRecordAction { return MalformedRecordDeadLetter })(c)
+
+		if _, err := c.normalizeRecords(context.Background(), "myShard", []types.Record{malformed}); err != nil {
+			t.Fatalf("normalize error: %v", err)
+		}
+		if len(sink.deadLetters) != 1 || sink.deadLetters[0].Record.ShardID != "myShard" || sink.deadLetters[0].Err == nil {
+			t.Fatalf("dead letters = %+v", sink.deadLetters)
+		}
+
+		sink.err = errors.New("sink down")
+		if _, err := c.normalizeRecords(context.Background(), "myShard", []types.Record{malformed}); !errors.Is(err, sink.err) {
+			t.Fatalf("error = %v, want sink error", err)
+		}
+	})
+}
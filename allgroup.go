@@ -16,8 +16,11 @@ func NewAllGroup(ksis kinesisClient, store Store, streamName string, logger Logg
 		ksis:         ksis,
 		shards:       make(map[string]types.Shard),
 		shardsClosed: make(map[string]chan struct{}),
+		inferred:     make(map[string]struct{}),
 		streamName:   streamName,
 		logger:       logger,
+		retryPolicy:  defaultRetryPolicy{},
+		retryWait:    waitWithContext,
 		Store:        store,
 	}
 }
@@ -26,14 +29,22 @@ func NewAllGroup(ksis kinesisClient, store Store, streamName string, logger Logg
 // caches a local list of the shards we are already processing
 // and routinely polls the stream looking for new shards to process.
 type AllGroup struct {
-	ksis       kinesisClient
-	streamName string
-	logger     Logger
+	ksis        kinesisClient
+	streamName  string
+	logger      Logger
+	retryPolicy RetryPolicy
+	retryWait   retryWaitFunc
 	Store
 
 	shardMu      sync.Mutex
 	shards       map[string]types.Shard
 	shardsClosed map[string]chan struct{}
+	// inferred holds the shards inferred to be fully consumed from the
+	// checkpoints of their descendants.
+	inferred map[string]struct{}
+
+	// senders tracks goroutines that may still deliver on shardC.
+	senders sync.WaitGroup
 }
 
 // Start is a blocking operation which will loop and attempt to find new
@@ -51,6 +62,12 @@ func (g *AllGroup) Start(ctx context.Context, shardC chan types.Shard) error {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
+	// The caller closes shardC once Start returns, so stop and wait for any
+	// goroutine still waiting to deliver a shard before returning.
+	ctx, cancel := context.WithCancel(ctx)
+	defer g.senders.Wait()
+	defer cancel()
+
 	for {
 		if err := g.findNewShards(ctx, shardC); err != nil {
 			return err
@@ -77,6 +94,64 @@ func (g *AllGroup) CloseShard(_ context.Context, shardID string) error {
 	return nil
 }
 
+// ParentsConsumed reports whether a parent of the shard was consumed, in
+// which case the consumer starts the shard at TRIM_HORIZON when it has no
+// checkpoint. A parent counts as consumed once it has been read to its end
+// and it was open when first listed, has a checkpoint, or was itself the child
+// of a consumed shard, or when a checkpoint on a descendant shows it was
+// consumed before a restart. Shards that were already closed when first
+// listed were skipped by the initial position, and so are their children.
+func (g *AllGroup) ParentsConsumed(_ context.Context, shardID string) (bool, error) {
+	g.shardMu.Lock()
+	defer g.shardMu.Unlock()
+
+	return g.parentsConsumed(shardID)
+}
+
+func (g *AllGroup) parentsConsumed(shardID string) (bool, error) {
+	shard, ok := g.shards[shardID]
+	if !ok {
+		return false, nil
+	}
+	for _, parentID := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+		if parentID == nil {
+			continue
+		}
+		consumed, err := g.shardConsumed(*parentID)
+		if err != nil || consumed {
+			return consumed, err
+		}
+	}
+	return false, nil
+}
+
+func (g *AllGroup) shardConsumed(shardID string) (bool, error) {
+	shard, ok := g.shards[shardID]
+	if !ok {
+		// trimmed from the stream before it was listed
+		return false, nil
+	}
+	if _, ok := g.inferred[shardID]; ok {
+		return true, nil
+	}
+	if _, ok := g.shardsClosed[shardID]; ok {
+		// not read to its end yet
+		return false, nil
+	}
+	if shard.SequenceNumberRange == nil || shard.SequenceNumberRange.EndingSequenceNumber == nil {
+		return true, nil
+	}
+
+	checkpoint, err := g.Store.GetCheckpoint(g.streamName, shardID)
+	if err != nil {
+		return false, err
+	}
+	if checkpoint != "" {
+		return true, nil
+	}
+	return g.parentsConsumed(shardID)
+}
+
 func (g *AllGroup) Flush() error {
 	flushable, ok := g.Store.(FlushableStore)
 	if !ok {
@@ -113,18 +188,19 @@ func (g *AllGroup) findNewShards(ctx context.Context, shardC chan types.Shard) e
 		adjacentParent <-chan struct{}
 	}
 
+	g.logger.Log("[GROUP]", "fetching shards")
+
+	// list outside the lock so retry backoff does not block CloseShard
+	shards, err := listShardsWithRetry(ctx, g.ksis, g.streamName, g.retryPolicy, g.retryWait, g.logger)
+	if err != nil {
+		g.logger.Log("[GROUP] error:", err)
+		return err
+	}
+
 	shardsToProcess, err := func() ([]shardWithParents, error) {
 		g.shardMu.Lock()
 		defer g.shardMu.Unlock()
 
-		g.logger.Log("[GROUP]", "fetching shards")
-
-		shards, err := listShards(ctx, g.ksis, g.streamName)
-		if err != nil {
-			g.logger.Log("[GROUP] error:", err)
-			return nil, err
-		}
-
 		completedAncestors, err := g.inferCompletedAncestors(shards)
 		if err != nil {
 			g.logger.Log("[GROUP] error inferring completed ancestors:", err)
@@ -144,6 +220,7 @@ func (g *AllGroup) findNewShards(ctx context.Context, shardC chan types.Shard) e
 			if _, ok := completedAncestors[*shard.ShardId]; ok {
 				// A checkpoint on a descendant implies this shard was already fully
 				// consumed before restart, so treat it as closed and do not re-emit it.
+				g.inferred[*shard.ShardId] = struct{}{}
 				continue
 			}
 			g.shardsClosed[*shard.ShardId] = make(chan struct{})
@@ -177,7 +254,9 @@ func (g *AllGroup) findNewShards(ctx context.Context, shardC chan types.Shard) e
 	// Now spawn goroutines after releasing the lock, using the captured channel references
 	for _, sp := range shardsToProcess {
 		sp := sp // Shadow variable for goroutine capture
+		g.senders.Add(1)
 		go func() {
+			defer g.senders.Done()
 			// Asynchronously wait for all parents of this shard to be processed
 			// before providing it out to our client.  Kinesis guarantees that a
 			// given partition key's data will be provided to clients in-order,
@@ -35,9 +35,18 @@ func newScanBatchRunner(consumer *Consumer, fn ScanBatchFunc, cfg scanBatchConfi
 func (r *scanBatchRunner) run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	scanID, ok := r.consumer.shutdown.startScan(cancel)
+	if !ok {
+		return nil
+	}
+	defer r.consumer.shutdown.endScan(scanID)
+	// records left buffered after a failed scan give their memory back
+	defer func() {
+		r.releaseMemory(r.buffers.drainAll())
+	}()
 
 	var tickerWG sync.WaitGroup
-	if r.cfg.flushInterval > 0 {
+	if r.cfg.flushInterval > 0 || r.consumer.memory != nil {
 		tickerWG.Add(1)
 		go func() {
 			defer tickerWG.Done()
@@ -45,15 +54,19 @@ func (r *scanBatchRunner) run(ctx context.Context) error {
 		}()
 	}
 
-	scanErr := r.consumer.Scan(ctx, func(record *Record) error {
-		shardID, batch := r.buffers.addAndMaybeDrain(record, r.cfg.maxSize)
-		if len(batch) > 0 {
-			if err := r.flush(ctx, map[string][]*Record{shardID: batch}); err != nil {
-				return err
+	scanErr := r.consumer.scan(ctx, func(context.Context) ScanFunc {
+		return func(record *Record) error {
+			// the record keeps its share of the page's memory until flushed
+			record.retained += record.memory.retain(recordSize(record))
+			shardID, batch := r.buffers.addAndMaybeDrain(record, r.cfg.maxSize)
+			if len(batch) > 0 {
+				if err := r.flush(ctx, map[string][]*Record{shardID: batch}); err != nil {
+					return err
+				}
 			}
+			return ErrSkipCheckpoint
 		}
-		return ErrSkipCheckpoint
-	})
+	}, shardHooks{})
 
 	cancel()
 	tickerWG.Wait()
@@ -65,7 +78,8 @@ func (r *scanBatchRunner) run(ctx context.Context) error {
 		return scanErr
 	}
 
-	if err := r.flush(context.Background(), r.buffers.drainAll()); err != nil {
+	// bounded by the Shutdown deadline when draining
+	if err := r.flush(r.consumer.shutdown.drainContext(), r.buffers.drainAll()); err != nil {
 		return err
 	}
 	if err := r.consumer.flushCheckpoints(); err != nil {
@@ -78,20 +92,27 @@ func (r *scanBatchRunner) run(ctx context.Context) error {
 	return scanErr
 }
 
+// runFlushTicker flushes every buffer on each tick of the flush interval and,
+// with a memory budget, whenever a shard waits for memory.
 func (r *scanBatchRunner) runFlushTicker(ctx context.Context, cancel context.CancelFunc) {
-	ticker := time.NewTicker(r.cfg.flushInterval)
-	defer ticker.Stop()
+	var tick <-chan time.Time
+	if r.cfg.flushInterval > 0 {
+		ticker := time.NewTicker(r.cfg.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if err := r.flush(ctx, r.buffers.drainAll()); err != nil {
-				r.setAsyncErr(fmt.Errorf("batch flush error: %w", err))
-				cancel()
-				return
-			}
+		case <-tick:
+		case <-r.consumer.memory.pressured():
+		}
+		if err := r.flush(ctx, r.buffers.drainAll()); err != nil {
+			r.setAsyncErr(fmt.Errorf("batch flush error: %w", err))
+			cancel()
+			return
 		}
 	}
 }
@@ -100,6 +121,7 @@ func (r *scanBatchRunner) flush(ctx context.Context, batches map[string][]*Recor
 	if len(batches) == 0 {
 		return nil
 	}
+	defer r.releaseMemory(batches)
 
 	r.flushMu.Lock()
 	defer r.flushMu.Unlock()
@@ -108,11 +130,11 @@ func (r *scanBatchRunner) flush(ctx context.Context, batches map[string][]*Recor
 		if len(batch) == 0 {
 			continue
 		}
-		if err := r.fn(batch); err != nil {
+		if err := r.call(shardID, batch); err != nil {
 			return err
 		}
 		last := batch[len(batch)-1]
-		if err := r.consumer.setCheckpointWithRetry(ctx, shardID, aws.ToString(last.SequenceNumber)); err != nil {
+		if err := r.consumer.setCheckpointWithRetry(ctx, shardID, last.checkpoint); err != nil {
 			return err
 		}
 	}
@@ -120,6 +142,33 @@ func (r *scanBatchRunner) flush(ctx context.Context, batches map[string][]*Recor
 	return nil
 }
 
+// call runs the batch callback through the middleware, which sees the first
+// record of the batch. A panic is returned as a *PanicError at that record, as
+// the callback may run on the flush ticker.
+func (r *scanBatchRunner) call(shardID string, batch []*Record) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = newPanicError(shardID, aws.ToString(batch[0].SequenceNumber), p)
+		}
+	}()
+	return r.consumer.applyMiddleware(func(*Record) error {
+		return r.fn(batch)
+	})(batch[0])
+}
+
+// releaseMemory gives the memory retained by buffered records back to the
+// budget.
+func (r *scanBatchRunner) releaseMemory(batches map[string][]*Record) {
+	var n int64
+	for _, batch := range batches {
+		for _, record := range batch {
+			n += record.retained
+			record.retained = 0
+		}
+	}
+	r.consumer.memory.release(n)
+}
+
 func (r *scanBatchRunner) setAsyncErr(err error) {
 	if err == nil {
 		return
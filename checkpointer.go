@@ -0,0 +1,222 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var (
+	// ErrStaleCheckpoint is returned by Checkpointer.CheckpointAt for a
+	// sequence number behind the shard's checkpoint.
+	ErrStaleCheckpoint = errors.New("sequence number is behind the checkpoint")
+	// ErrUnknownSequenceNumber is returned by Checkpointer.CheckpointAt for a
+	// sequence number that was not delivered from the checkpointer's shard.
+	ErrUnknownSequenceNumber = errors.New("sequence number was not delivered from the shard")
+	// ErrShardReleased is returned by a Checkpointer once the consumer has
+	// stopped reading its shard, which may now be read by another consumer.
+	ErrShardReleased = errors.New("shard was released")
+)
+
+// ManualScanFunc is called for each record with the Checkpointer of its
+// shard. Records are only checkpointed through the checkpointer. If an error
+// is returned, scanning stops.
+type ManualScanFunc func(*Record, *Checkpointer) error
+
+// ScanManual scans all shards like Scan, but leaves checkpointing to fn, e.g.
+// once records written asynchronously are durable. The Checkpointer may be
+// kept and used from other goroutines until the consumer stops reading the
+// shard; it then returns ErrShardReleased. Records not checkpointed when a
+// shard is handed back are read again by its next consumer; records not
+// checkpointed when a shard ends are not, as the shard is closed.
+func (c *Consumer) ScanManual(ctx context.Context, fn ManualScanFunc) error {
+	if fn == nil {
+		return errors.New("manual scan callback is required")
+	}
+	if c.partitionKeyConcurrency > 1 {
+		return errors.New("partition key concurrency is not supported with ScanManual")
+	}
+
+	var (
+		mu            sync.Mutex
+		checkpointers = make(map[string]*Checkpointer)
+	)
+	checkpointer := func(shardID string) *Checkpointer {
+		mu.Lock()
+		defer mu.Unlock()
+		return checkpointers[shardID]
+	}
+
+	return c.scan(ctx, func(ctx context.Context) ScanFunc {
+		scanFn := c.deadLetterScanFunc(ctx, c.applyMiddleware(func(r *Record) error {
+			return fn(r, checkpointer(r.ShardID))
+		}))
+		return func(r *Record) error {
+			checkpointer(r.ShardID).deliver(r)
+			if err := scanFn(r); err != nil && !errors.Is(err, ErrSkipCheckpoint) {
+				return err
+			}
+			return ErrSkipCheckpoint
+		}
+	}, shardHooks{
+		start: func(ctx context.Context, shardID string) error {
+			seqNum, err := c.group.GetCheckpoint(c.streamName, shardID)
+			if err != nil {
+				return fmt.Errorf("get checkpoint error: %w", err)
+			}
+			mu.Lock()
+			checkpointers[shardID] = newCheckpointer(c, shardID, seqNum)
+			mu.Unlock()
+			return nil
+		},
+		beforeClose: func(ctx context.Context, shardID string, stop shardStop) error {
+			mu.Lock()
+			cp := checkpointers[shardID]
+			delete(checkpointers, shardID)
+			mu.Unlock()
+			cp.release()
+			return nil
+		},
+	})
+}
+
+// Checkpointer records the progress of a shard read by ScanManual or
+// ScanProcessor. It is safe for concurrent use. Once the consumer stops
+// reading the shard, checkpoints fail with ErrShardReleased so they do not
+// overwrite those of the shard's next consumer.
+type Checkpointer struct {
+	consumer *Consumer
+	shardID  string
+
+	// checkpointMu keeps checkpoints in order
+	checkpointMu sync.Mutex
+
+	mu        sync.Mutex
+	current   string
+	delivered []deliveredRecord
+	released  bool
+}
+
+// deliveredRecord is a record delivered after the current checkpoint.
+type deliveredRecord struct {
+	sequenceNumber string
+	checkpoint     string
+}
+
+func newCheckpointer(c *Consumer, shardID, current string) *Checkpointer {
+	return &Checkpointer{consumer: c, shardID: shardID, current: current}
+}
+
+// Checkpoint marks every record delivered so far as processed.
+func (cp *Checkpointer) Checkpoint(ctx context.Context) error {
+	return cp.checkpoint(ctx, func(delivered []deliveredRecord) (int, error) {
+		return len(delivered) - 1, nil
+	})
+}
+
+// CheckpointAt marks the delivered records up to the one with the sequence
+// number as processed. For a KPL aggregated record it covers the user records
+// of the aggregate delivered so far. It returns ErrStaleCheckpoint when the
+// sequence number is behind the checkpoint, and ErrUnknownSequenceNumber when
+// it was not delivered from the shard.
+func (cp *Checkpointer) CheckpointAt(ctx context.Context, sequenceNumber string) error {
+	return cp.checkpoint(ctx, func(delivered []deliveredRecord) (int, error) {
+		for i := len(delivered) - 1; i >= 0; i-- {
+			if delivered[i].sequenceNumber == sequenceNumber {
+				return i, nil
+			}
+		}
+
+		current, _, _ := parseCheckpoint(cp.current)
+		if cp.current != "" {
+			switch compareSequenceNumbers(sequenceNumber, current) {
+			case -1:
+				return -1, fmt.Errorf("checkpoint %s at %s: %w", cp.shardID, sequenceNumber, ErrStaleCheckpoint)
+			case 0:
+				// already checkpointed
+				return -1, nil
+			}
+		}
+		return -1, fmt.Errorf("checkpoint %s at %s: %w", cp.shardID, sequenceNumber, ErrUnknownSequenceNumber)
+	})
+}
+
+// checkpoint sets the checkpoint at the delivered record find returns. A
+// negative index leaves the checkpoint as is.
+func (cp *Checkpointer) checkpoint(ctx context.Context, find func([]deliveredRecord) (int, error)) error {
+	cp.checkpointMu.Lock()
+	defer cp.checkpointMu.Unlock()
+
+	cp.mu.Lock()
+	if cp.released {
+		cp.mu.Unlock()
+		return fmt.Errorf("checkpoint %s: %w", cp.shardID, ErrShardReleased)
+	}
+	i, err := find(cp.delivered)
+	var record deliveredRecord
+	if i >= 0 {
+		record = cp.delivered[i]
+	}
+	cp.mu.Unlock()
+	if err != nil || i < 0 {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cp.consumer.setCheckpointWithRetry(ctx, cp.shardID, record.checkpoint); err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.current = record.checkpoint
+	cp.delivered = cp.delivered[i+1:]
+	return nil
+}
+
+// release makes later checkpoints fail with ErrShardReleased. It waits for a
+// checkpoint in progress.
+func (cp *Checkpointer) release() {
+	if cp == nil {
+		return
+	}
+
+	cp.checkpointMu.Lock()
+	defer cp.checkpointMu.Unlock()
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.released = true
+}
+
+func (cp *Checkpointer) deliver(records ...*Record) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	for _, r := range records {
+		cp.delivered = append(cp.delivered, deliveredRecord{
+			sequenceNumber: aws.ToString(r.SequenceNumber),
+			checkpoint:     r.checkpoint,
+		})
+	}
+}
+
+// compareSequenceNumbers compares two Kinesis sequence numbers, which are
+// decimal strings without leading zeros.
+func compareSequenceNumbers(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
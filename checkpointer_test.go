@@ -0,0 +1,118 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func TestCheckpointer_CheckpointAtValidatesSequenceNumbers(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(&kinesisClientMock{}), WithStore(cp))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	checkpointer := newCheckpointer(c, "myShard", "100")
+	for _, seqNum := range []string{"101", "102", "103"} {
+		checkpointer.deliver(&Record{Record: types.Record{SequenceNumber: aws.String(seqNum)}, checkpoint: seqNum})
+	}
+
+	ctx := context.Background()
+	if err := checkpointer.CheckpointAt(ctx, "99"); !errors.Is(err, ErrStaleCheckpoint) {
+		t.Fatalf("checkpoint behind error = %v, want ErrStaleCheckpoint", err)
+	}
+	if err := checkpointer.CheckpointAt(ctx, "1000"); !errors.Is(err, ErrUnknownSequenceNumber) {
+		t.Fatalf("checkpoint from another shard error = %v, want ErrUnknownSequenceNumber", err)
+	}
+
+	if err := checkpointer.CheckpointAt(ctx, "102"); err != nil {
+		t.Fatalf("checkpoint at 102 error: %v", err)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "102" {
+		t.Fatalf("checkpoint = %q, want 102", val)
+	}
+	if err := checkpointer.CheckpointAt(ctx, "101"); !errors.Is(err, ErrStaleCheckpoint) {
+		t.Fatalf("checkpoint behind error = %v, want ErrStaleCheckpoint", err)
+	}
+	if err := checkpointer.CheckpointAt(ctx, "102"); err != nil {
+		t.Fatalf("repeated checkpoint error = %v, want nil", err)
+	}
+
+	if err := checkpointer.Checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "103" {
+		t.Fatalf("checkpoint = %q, want 103", val)
+	}
+}
+
+func TestScanManual_CheckpointsOnlyThroughCheckpointer(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newOpenShardClient()), WithStore(cp))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err = c.ScanManual(ctx, func(r *Record, checkpointer *Checkpointer) error {
+		if aws.ToString(r.SequenceNumber) != "lastSeqNum" {
+			return nil
+		}
+		// only the first record is durable
+		defer cancel()
+		return checkpointer.CheckpointAt(ctx, "firstSeqNum")
+	})
+	if err != nil {
+		t.Fatalf("scan manual error: %v", err)
+	}
+
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "firstSeqNum" {
+		t.Fatalf("checkpoint = %q, want firstSeqNum", val)
+	}
+}
+
+func TestScanManual_CheckpointAfterLeaseLostIsRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	group := &leaseLosingGroup{multiShardRebalanceAwareGroupMock: &multiShardRebalanceAwareGroupMock{
+		shards: []string{"myShard"},
+		shardStoppedMock: func(ctx context.Context, shardID string) error {
+			cancel()
+			return nil
+		},
+	}}
+	c, err := New("myStreamName", WithClient(newOpenShardClient()), WithGroup(group), WithScanInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	var kept *Checkpointer
+	err = c.ScanManual(ctx, func(r *Record, checkpointer *Checkpointer) error {
+		// the records are committed asynchronously, after the lease is lost
+		kept = checkpointer
+		if aws.ToString(r.SequenceNumber) == "lastSeqNum" {
+			group.loseLease()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan manual error: %v", err)
+	}
+
+	if err := kept.Checkpoint(context.Background()); !errors.Is(err, ErrShardReleased) {
+		t.Fatalf("checkpoint after lease lost error = %v, want ErrShardReleased", err)
+	}
+	if err := kept.CheckpointAt(context.Background(), "firstSeqNum"); !errors.Is(err, ErrShardReleased) {
+		t.Fatalf("checkpoint at after lease lost error = %v, want ErrShardReleased", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 )
 
 // kinesisClient defines the interface of functions needed for the consumer
@@ -12,3 +13,37 @@ type kinesisClient interface {
 	ListShards(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error)
 	GetShardIterator(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error)
 }
+
+// kinesisStreamingClient extends kinesisClient with the enhanced fan-out
+// SubscribeToShard call.
+type kinesisStreamingClient interface {
+	kinesisClient
+	SubscribeToShard(ctx context.Context, params *kinesis.SubscribeToShardInput, optFns ...func(*kinesis.Options)) (*kinesis.SubscribeToShardOutput, error)
+}
+
+// shardEventStream is the subset of kinesis.SubscribeToShardEventStream used
+// by the consumer.
+type shardEventStream interface {
+	Events() <-chan types.SubscribeToShardEventStream
+	Close() error
+	Err() error
+}
+
+// shardSubscriber opens a SubscribeToShard event stream. It exists so tests
+// can supply events without constructing SDK outputs, whose stream is unexported.
+type shardSubscriber interface {
+	SubscribeToShard(ctx context.Context, params *kinesis.SubscribeToShardInput) (shardEventStream, error)
+}
+
+// streamingClientSubscriber adapts a kinesisStreamingClient to shardSubscriber.
+type streamingClientSubscriber struct {
+	client kinesisStreamingClient
+}
+
+func (s *streamingClientSubscriber) SubscribeToShard(ctx context.Context, params *kinesis.SubscribeToShardInput) (shardEventStream, error) {
+	out, err := s.client.SubscribeToShard(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return out.GetStream(), nil
+}
@@ -0,0 +1,106 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// CloudWatch Logs subscription message types.
+const (
+	CloudWatchLogsDataMessage    = "DATA_MESSAGE"
+	CloudWatchLogsControlMessage = "CONTROL_MESSAGE"
+)
+
+// CloudWatchLogsData is the envelope CloudWatch Logs subscription filters put
+// on the stream. Its log events all belong to one log group and stream.
+type CloudWatchLogsData struct {
+	MessageType         string                   `json:"messageType"`
+	Owner               string                   `json:"owner"`
+	LogGroup            string                   `json:"logGroup"`
+	LogStream           string                   `json:"logStream"`
+	SubscriptionFilters []string                 `json:"subscriptionFilters"`
+	LogEvents           []CloudWatchLogsLogEvent `json:"logEvents"`
+}
+
+// CloudWatchLogsLogEvent is a log event as it appears in the envelope.
+// Timestamp is in milliseconds since the epoch.
+type CloudWatchLogsLogEvent struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// CloudWatchLogEvent is a single log event together with the log group and
+// stream it was written to.
+type CloudWatchLogEvent struct {
+	Owner               string
+	LogGroup            string
+	LogStream           string
+	SubscriptionFilters []string
+	ID                  string
+	Timestamp           time.Time
+	Message             string
+}
+
+// CloudWatchLogsDecoder decodes the envelope of a CloudWatch Logs
+// subscription record. The data may be gzip compressed, as CloudWatch Logs
+// writes it, or already decompressed by WithPayloadCodec.
+type CloudWatchLogsDecoder struct{}
+
+func (CloudWatchLogsDecoder) Decode(data []byte) (CloudWatchLogsData, error) {
+	var v CloudWatchLogsData
+	if GzipCodec.Detect(data) {
+		var err error
+		if data, err = GzipCodec.Decode(data); err != nil {
+			return v, err
+		}
+	}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// ScanCloudWatchLogs scans with s and calls fn once for each log event of each
+// CloudWatch Logs subscription record. Control messages, which CloudWatch Logs
+// sends to check the destination is reachable, are dropped.
+//
+// Records are still checkpointed whole: a record is checkpointed once fn has
+// returned for all of its events. An error from fn stops the scan as with
+// Scan. ErrSkipCheckpoint from any event leaves the record without a
+// checkpoint once its remaining events have been delivered. Records that fail
+// to decode follow the DecodeErrorPolicy.
+func ScanCloudWatchLogs(ctx context.Context, s Scanner, fn func(*Record, CloudWatchLogEvent) error, opts ...ScanTypedOption) error {
+	if fn == nil {
+		return errors.New("callback is required")
+	}
+
+	return ScanTyped(ctx, s, CloudWatchLogsDecoder{}, func(r *Record, data CloudWatchLogsData) error {
+		if data.MessageType == CloudWatchLogsControlMessage {
+			return nil
+		}
+
+		var skipCheckpoint bool
+		for _, e := range data.LogEvents {
+			err := fn(r, CloudWatchLogEvent{
+				Owner:               data.Owner,
+				LogGroup:            data.LogGroup,
+				LogStream:           data.LogStream,
+				SubscriptionFilters: data.SubscriptionFilters,
+				ID:                  e.ID,
+				Timestamp:           time.UnixMilli(e.Timestamp),
+				Message:             e.Message,
+			})
+			switch {
+			case errors.Is(err, ErrSkipCheckpoint):
+				skipCheckpoint = true
+			case err != nil:
+				return err
+			}
+		}
+		if skipCheckpoint {
+			return ErrSkipCheckpoint
+		}
+		return nil
+	}, opts...)
+}
@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func cloudWatchLogsRecord(t *testing.T, seqNum string, data CloudWatchLogsData) types.Record {
+	t.Helper()
+	body, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+	return types.Record{SequenceNumber: aws.String(seqNum), Data: compress(t, "gzip", body)}
+}
+
+func TestScanCloudWatchLogs(t *testing.T) {
+	page := []types.Record{
+		cloudWatchLogsRecord(t, "seq-1", CloudWatchLogsData{
+			MessageType: CloudWatchLogsControlMessage,
+			LogEvents:   []CloudWatchLogsLogEvent{{ID: "control", Message: "CWL CONTROL MESSAGE: Checking health of destination"}},
+		}),
+		cloudWatchLogsRecord(t, "seq-2", CloudWatchLogsData{
+			MessageType: CloudWatchLogsDataMessage,
+			LogGroup:    "/app/api",
+			LogStream:   "i-123",
+			LogEvents: []CloudWatchLogsLogEvent{
+				{ID: "1", Timestamp: 1700000000000, Message: "started"},
+				{ID: "2", Timestamp: 1700000000500, Message: "fail"},
+			},
+		}),
+		cloudWatchLogsRecord(t, "seq-3", CloudWatchLogsData{
+			MessageType: CloudWatchLogsDataMessage,
+			LogGroup:    "/app/api",
+			LogStream:   "i-123",
+			LogEvents:   []CloudWatchLogsLogEvent{{ID: "3", Timestamp: 1700000001000, Message: "stopped"}},
+		}),
+	}
+
+	newShard := func(t *testing.T) (Scanner, *store.Store) {
+		client := &kinesisClientMock{
+			getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+				return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter")}, nil
+			},
+			getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+				return &kinesis.GetRecordsOutput{Records: page}, nil
+			},
+		}
+		cp := store.New()
+		c, err := New("myStreamName", WithClient(client), WithStore(cp))
+		if err != nil {
+			t.Fatalf("new consumer error: %v", err)
+		}
+		return scannerFunc(func(ctx context.Context, fn ScanFunc) error {
+			return c.ScanShard(ctx, "myShard", fn)
+		}), cp
+	}
+
+	t.Run("expands log events", func(t *testing.T) {
+		shard, cp := newShard(t)
+		var events []CloudWatchLogEvent
+		err := ScanCloudWatchLogs(context.Background(), shard, func(r *Record, e CloudWatchLogEvent) error {
+			events = append(events, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if len(events) != 3 || events[0].Message != "started" || events[2].ID != "3" {
+			t.Fatalf("events = %+v, want the 3 data message events", events)
+		}
+		if e := events[1]; e.LogGroup != "/app/api" || e.LogStream != "i-123" || e.Timestamp.UnixMilli() != 1700000000500 {
+			t.Fatalf("event = %+v, want log group, stream and timestamp", e)
+		}
+		if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "seq-3" {
+			t.Fatalf("checkpoint = %q, want seq-3", val)
+		}
+	})
+
+	t.Run("checkpoints at the record boundary", func(t *testing.T) {
+		shard, cp := newShard(t)
+		errFail := errors.New("fail")
+		err := ScanCloudWatchLogs(context.Background(), shard, func(r *Record, e CloudWatchLogEvent) error {
+			if e.Message == "fail" {
+				return errFail
+			}
+			return nil
+		})
+		if !errors.Is(err, errFail) {
+			t.Fatalf("scan error = %v, want %v", err, errFail)
+		}
+		// the control message is checkpointed; the record of the failed event is not
+		if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "seq-1" {
+			t.Fatalf("checkpoint = %q, want seq-1", val)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// PayloadCodec decodes the data of records written by a producer that
+// compresses its payloads.
+type PayloadCodec interface {
+	// Name identifies the codec in errors and logs.
+	Name() string
+	// Detect reports whether data was encoded with the codec.
+	Detect(data []byte) bool
+	// Decode returns the decoded data.
+	Decode(data []byte) ([]byte, error)
+}
+
+// The built-in codecs are detected by the magic bytes of their formats. Snappy
+// payloads must use the framing format; raw snappy blocks have no header to
+// detect. The zlib header is only two bytes that plain payloads, e.g.
+// protobuf messages, often start with, so ZlibCodec is not a default codec and
+// should only be used for streams whose payloads are all zlib compressed.
+var (
+	GzipCodec   PayloadCodec = magicCodec{"gzip", []byte{0x1f, 0x8b, 0x08}, decodeGzip}
+	ZstdCodec   PayloadCodec = magicCodec{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}, decodeZstd}
+	SnappyCodec PayloadCodec = magicCodec{"snappy", []byte("\xff\x06\x00\x00sNaPpY"), decodeSnappy}
+	ZlibCodec   PayloadCodec = zlibCodec{}
+)
+
+// defaultPayloadCodecs are tried when WithPayloadCodec is given no codecs.
+var defaultPayloadCodecs = []PayloadCodec{GzipCodec, ZstdCodec, SnappyCodec}
+
+// decodePayload decodes data with the first codec that detects it. Data no
+// codec detects is returned as it is.
+func decodePayload(codecs []PayloadCodec, data []byte) ([]byte, error) {
+	for _, codec := range codecs {
+		if !codec.Detect(data) {
+			continue
+		}
+		decoded, err := codec.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s payload: %w", codec.Name(), err)
+		}
+		return decoded, nil
+	}
+	return data, nil
+}
+
+type magicCodec struct {
+	name   string
+	magic  []byte
+	decode func([]byte) ([]byte, error)
+}
+
+func (c magicCodec) Name() string                       { return c.name }
+func (c magicCodec) Detect(data []byte) bool            { return bytes.HasPrefix(data, c.magic) }
+func (c magicCodec) Decode(data []byte) ([]byte, error) { return c.decode(data) }
+
+// zlibCodec detects the two-byte zlib header: deflate with a window of at most
+// 32K and a check value making the header a multiple of 31.
+type zlibCodec struct{}
+
+func (zlibCodec) Name() string { return "zlib" }
+
+func (zlibCodec) Detect(data []byte) bool {
+	return len(data) >= 2 && data[0]&0x0f == 8 && data[0]>>4 <= 7 && data[1]&0x20 == 0 &&
+		(uint16(data[0])<<8|uint16(data[1]))%31 == 0
+}
+
+func (zlibCodec) Decode(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func decodeGzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// zstdDecoder is shared by every shard; DecodeAll is safe for concurrent use.
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil)
+})
+
+func decodeZstd(data []byte) ([]byte, error) {
+	d, err := zstdDecoder()
+	if err != nil {
+		return nil, err
+	}
+	return d.DecodeAll(data, nil)
+}
+
+func decodeSnappy(data []byte) ([]byte, error) {
+	return io.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+}
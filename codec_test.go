@@ -0,0 +1,144 @@
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	rec "github.com/awslabs/kinesis-aggregation/go/v2/records"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+func compress(t *testing.T, codec string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w interface {
+		Write([]byte) (int, error)
+		Close() error
+	}
+	switch codec {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "snappy":
+		w = snappy.NewBufferedWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("new zstd writer: %v", err)
+		}
+		w = zw
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("compress %s: %v", codec, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("compress %s: %v", codec, err)
+	}
+	return buf.Bytes()
+}
+
+func TestNormalizeRecords_PayloadCodecs(t *testing.T) {
+	c := &Consumer{counter: &fakeCounter{}, logger: &testLogger{t}}
+	WithPayloadCodec()(c)
+
+	payload := []byte(`{"event":"signup"}`)
+	for _, codec := range []string{"gzip", "zstd", "snappy"} {
+		records := []types.Record{{SequenceNumber: aws.String("seq-1"), Data: compress(t, codec, payload)}}
+		got, err := c.normalizeRecords(context.Background(), "myShard", records)
+		if err != nil {
+			t.Fatalf("%s: normalize error: %v", codec, err)
+		}
+		if len(got) != 1 || !bytes.Equal(got[0].Data, payload) {
+			t.Fatalf("%s: records = %+v, want decoded payload", codec, got)
+		}
+	}
+
+	plain := []types.Record{{SequenceNumber: aws.String("seq-1"), Data: payload}}
+	if got, err := c.normalizeRecords(context.Background(), "myShard", plain); err != nil || !bytes.Equal(got[0].Data, payload) {
+		t.Fatalf("plain record = %+v, %v; want delivered as is", got, err)
+	}
+}
+
+func TestNormalizeRecords_ZlibCodecIsOptIn(t *testing.T) {
+	c := &Consumer{counter: &fakeCounter{}, logger: &testLogger{t}}
+	WithPayloadCodec()(c)
+
+	// plain payloads whose first two bytes form a valid zlib header
+	for _, payload := range [][]byte{
+		{0x08, 0x1d, 0x12, 0x06, 's', 'i', 'g', 'n', 'u', 'p'},
+		[]byte("x^hello"),
+		[]byte("HK"),
+	} {
+		if !ZlibCodec.Detect(payload) {
+			t.Fatalf("ZlibCodec.Detect(%q) = false, want a zlib-looking header", payload)
+		}
+		records := []types.Record{{SequenceNumber: aws.String("seq-1"), Data: payload}}
+		got, err := c.normalizeRecords(context.Background(), "myShard", records)
+		if err != nil || len(got) != 1 || !bytes.Equal(got[0].Data, payload) {
+			t.Fatalf("record %q = %+v, %v; want delivered as is", payload, got, err)
+		}
+	}
+
+	WithPayloadCodec(ZlibCodec)(c)
+	payload := []byte(`{"event":"signup"}`)
+	records := []types.Record{{SequenceNumber: aws.String("seq-1"), Data: compress(t, "zlib", payload)}}
+	got, err := c.normalizeRecords(context.Background(), "myShard", records)
+	if err != nil || len(got) != 1 || !bytes.Equal(got[0].Data, payload) {
+		t.Fatalf("zlib record = %+v, %v; want decoded payload", got, err)
+	}
+}
+
+func TestNormalizeRecords_PayloadCodecAfterDeaggregation(t *testing.T) {
+	c := &Consumer{isAggregated: true, counter: &fakeCounter{}, logger: &testLogger{t}}
+	WithPayloadCodec(GzipCodec)(c)
+
+	agg := kplRecord(t, "agg", &rec.AggregatedRecord{
+		PartitionKeyTable: []string{"a"},
+		Records: []*rec.Record{
+			{PartitionKeyIndex: proto.Uint64(0), Data: compress(t, "gzip", []byte("one"))},
+			{PartitionKeyIndex: proto.Uint64(0), Data: []byte("two")},
+		},
+	})
+	got, err := c.normalizeRecords(context.Background(), "myShard", []types.Record{agg})
+	if err != nil {
+		t.Fatalf("normalize error: %v", err)
+	}
+	if len(got) != 2 || string(got[0].Data) != "one" || string(got[1].Data) != "two" {
+		t.Fatalf("records = %+v, want decoded user records", got)
+	}
+}
+
+func TestNormalizeRecords_CorruptPayloadIsMalformed(t *testing.T) {
+	ctr := &fakeCounter{}
+	var handled error
+	c := &Consumer{counter: ctr, logger: &testLogger{t}}
+	WithPayloadCodec()(c)
+	WithMalformedRecordHandler(func(r *Record, err error) MalformedRecordAction {
+		handled = err
+		return MalformedRecordSkip
+	})(c)
+
+	corrupt := compress(t, "gzip", []byte("payload"))[:12]
+	records := []types.Record{
+		{SequenceNumber: aws.String("seq-1"), Data: corrupt},
+		{SequenceNumber: aws.String("seq-2"), Data: []byte("plain")},
+	}
+	got, err := c.normalizeRecords(context.Background(), "myShard", records)
+	if err != nil {
+		t.Fatalf("normalize error: %v", err)
+	}
+	if handled == nil || len(got) != 1 || aws.ToString(got[0].SequenceNumber) != "seq-2" {
+		t.Fatalf("handled %v, records %+v; want seq-1 skipped", handled, got)
+	}
+	if ctr.Get() != 1 {
+		t.Fatalf("malformed records counted = %d, want 1", ctr.Get())
+	}
+}
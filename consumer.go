@@ -14,15 +14,33 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
-	"github.com/awslabs/kinesis-aggregation/go/v2/deaggregator"
 )
 
 // Record wraps the record returned from the Kinesis library and
-// extends to include the shard id.
+// extends to include the stream and shard id.
 type Record struct {
 	types.Record
 	ShardID            string
 	MillisBehindLatest *int64
+	StreamName         string
+	// SubSequenceNumber is the position of a deaggregated user record within
+	// its KPL aggregated record. It is zero for records that were not
+	// aggregated.
+	SubSequenceNumber int64
+
+	checkpoint string
+	ack        *recordAck
+	// counter is the consumer's counter, for middleware.
+	counter Counter
+	// deadLettered marks a record the dead-letter sink took after the
+	// callback failed.
+	deadLettered bool
+	// memory is the budget lease of the record's page; retained is what a
+	// ScanBatch buffer took from it for the record.
+	memory   *memoryLease
+	retained int64
+	// endOfPage marks the last record of a page processed in order.
+	endOfPage bool
 }
 
 // New creates a kinesis consumer with default settings. Use Option to override
@@ -45,6 +63,7 @@ func New(streamName string, opts ...Option) (*Consumer, error) {
 		scanInterval: 250 * time.Millisecond,
 		maxRecords:   10000,
 		retryWait:    waitWithContext,
+		retryPolicy:  defaultRetryPolicy{},
 	}
 
 	// override defaults
@@ -52,6 +71,12 @@ func New(streamName string, opts ...Option) (*Consumer, error) {
 		opt(c)
 	}
 
+	if isStreamARN(c.streamName) {
+		if err := validateStreamARN(c.streamName); err != nil {
+			return nil, err
+		}
+	}
+
 	// default client
 	if c.client == nil {
 		cfg, err := config.LoadDefaultConfig(context.TODO())
@@ -61,14 +86,41 @@ func New(streamName string, opts ...Option) (*Consumer, error) {
 		c.client = kinesis.NewFromConfig(cfg)
 	}
 
+	if c.streamConsumer != nil {
+		consumerARN, err := c.registerStreamConsumer(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		c.consumerARN = consumerARN
+	}
+
+	if c.consumerARN != "" && c.subscriber == nil {
+		streamingClient, ok := c.client.(kinesisStreamingClient)
+		if !ok {
+			return nil, errors.New("enhanced fan-out requires a client that supports SubscribeToShard")
+		}
+		c.subscriber = &streamingClientSubscriber{client: streamingClient}
+	}
+
 	// default group consumes all shards
 	if c.group == nil {
-		c.group = NewAllGroup(c.client, c.store, streamName, c.logger)
+		group := NewAllGroup(c.client, c.store, c.streamName, c.logger)
+		group.retryPolicy = c.retryPolicy
+		c.group = group
 	}
 
 	return c, nil
 }
 
+// NewFromARN creates a kinesis consumer that addresses the stream by ARN, which
+// is required for cross-account streams. Checkpoints are keyed by the ARN.
+func NewFromARN(streamARN string, opts ...Option) (*Consumer, error) {
+	if err := validateStreamARN(streamARN); err != nil {
+		return nil, err
+	}
+	return New(streamARN, opts...)
+}
+
 // Consumer wraps the interaction with the Kinesis stream
 type Consumer struct {
 	streamName               string
@@ -85,6 +137,21 @@ type Consumer struct {
 	shardClosedHandler       ShardClosedHandler
 	getRecordsOpts           []func(*kinesis.Options)
 	retryWait                retryWaitFunc
+	consumerARN              string
+	streamConsumer           *streamConsumerConfig
+	subscriber               shardSubscriber
+	partitionKeyConcurrency  int
+	deadLetter               *deadLetterConfig
+	retryPolicy              RetryPolicy
+	malformedRecordHandler   MalformedRecordHandler
+	adaptivePolling          *adaptivePollingConfig
+	readLimiter              *ReadLimiter
+	prefetch                 int
+	payloadCodecs            []PayloadCodec
+	middleware               []Middleware
+	shutdown                 shutdownState
+	pauses                   pauseState
+	memory                   *memoryBudget
 }
 
 // ScanFunc is the type of the function called for each message read
@@ -147,18 +214,60 @@ type retryWaitFunc func(context.Context, time.Duration) bool
 // is passed through to each of the goroutines and called with each message pulled from
 // the stream.
 func (c *Consumer) Scan(ctx context.Context, fn ScanFunc) error {
+	return c.scan(ctx, func(ctx context.Context) ScanFunc {
+		return c.deadLetterScanFunc(ctx, c.applyMiddleware(fn))
+	}, shardHooks{})
+}
+
+// shardStop says why scan stopped reading a shard.
+type shardStop int
+
+const (
+	// shardEnded means the shard was read to its end.
+	shardEnded shardStop = iota
+	// shardDrained means Shutdown was called or the scan is stopping.
+	shardDrained
+	// shardLeaseLost means the group assigned the shard elsewhere.
+	shardLeaseLost
+)
+
+// shardHooks are called by scan from the goroutine of each shard. Either may
+// be nil.
+type shardHooks struct {
+	// start is called before the shard is read. An error stops the scan.
+	start func(ctx context.Context, shardID string) error
+	// beforeClose is called once the shard stopped without an error, before
+	// it is handed back to the group. An error stops the scan, and a shard
+	// that ended is then not closed.
+	beforeClose func(ctx context.Context, shardID string, stop shardStop) error
+}
+
+// scan implements Scan. newFn builds the callback from the scan's own context,
+// which is cancelled as soon as any shard fails.
+func (c *Consumer) scan(ctx context.Context, newFn func(ctx context.Context) ScanFunc, hooks shardHooks) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	scanID, ok := c.shutdown.startScan(cancel)
+	if !ok {
+		return nil
+	}
+	defer c.shutdown.endScan(scanID)
+	fn := recoverScanFunc(newFn(ctx))
 
 	var (
-		errC   = make(chan error, 1)
-		shardC = make(chan types.Shard, 1)
+		errC      = make(chan error, 1)
+		shardC    = make(chan types.Shard, 1)
+		groupDone = make(chan struct{})
 	)
 
 	go func() {
+		defer close(groupDone)
 		err := c.group.Start(ctx, shardC)
 		if err != nil {
-			errC <- fmt.Errorf("error starting scan: %w", err)
+			select {
+			case errC <- fmt.Errorf("error starting scan: %w", err):
+			default:
+			}
 			cancel()
 		}
 		<-ctx.Done()
@@ -166,9 +275,22 @@ func (c *Consumer) Scan(ctx context.Context, fn ScanFunc) error {
 	}()
 
 	wg := new(sync.WaitGroup)
-	// process each of the shards
+	// process each of the shards until the group stops or Shutdown is called
 	s := newShardsInProcess()
-	for shard := range shardC {
+	stopped := c.shutdown.stopped().Done()
+shards:
+	for {
+		var shard types.Shard
+		select {
+		case <-stopped:
+			break shards
+		case next, ok := <-shardC:
+			if !ok {
+				break shards
+			}
+			shard = next
+		}
+
 		shardId := aws.ToString(shard.ShardId)
 		if !s.tryAddShard(shardId) {
 			// safetynet: if shard already in process by another goroutine, just skipping the request
@@ -191,18 +313,55 @@ func (c *Consumer) Scan(ctx context.Context, fn ScanFunc) error {
 			defer shardCleanup()
 
 			var err error
-			if err = c.scanShard(shardCtx, shardID, fn); err != nil {
+			if hooks.start != nil {
+				err = hooks.start(shardCtx, shardID)
+			}
+			if err == nil {
+				err = c.scanShardRecover(shardCtx, shardID, fn)
+			}
+			if err != nil {
+				var panicErr *PanicError
+				if errors.As(err, &panicErr) {
+					c.logger.Log("[CONSUMER] shard panic:", shardID, panicErr.Value, string(panicErr.Stack))
+					// hand the lease back now rather than leave it to expire
+					if stoppable, ok := c.group.(shardStopHandler); ok {
+						if stopErr := stoppable.ShardStopped(context.Background(), shardID); stopErr != nil {
+							err = errors.Join(err, fmt.Errorf("shard stopped error: %w", stopErr))
+						}
+					}
+				}
 				err = fmt.Errorf("shard %s error: %w", shardID, err)
 			} else if hasShardContext && shardCtx.Err() != nil {
+				stop := shardLeaseLost
+				if ctx.Err() != nil {
+					stop = shardDrained
+				}
+				err = hooks.beforeCloseShard(ctx, shardID, stop)
 				if stoppable, ok := c.group.(shardStopHandler); ok {
-					if err = stoppable.ShardStopped(context.Background(), shardID); err != nil {
-						err = fmt.Errorf("shard stopped error: %w", err)
+					if stopErr := stoppable.ShardStopped(context.Background(), shardID); stopErr != nil {
+						err = errors.Join(err, fmt.Errorf("shard stopped error: %w", stopErr))
 					}
 				}
-			} else if closeable, ok := c.group.(CloseableGroup); !ok {
-				// group doesn't allow closure, skip calling CloseShard
-			} else if err = closeable.CloseShard(context.Background(), shardID); err != nil {
-				err = fmt.Errorf("shard closed CloseableGroup error: %w", err)
+			} else if c.shutdown.stopped().Err() != nil {
+				// drained by Shutdown; the shard is not finished, so hand it back
+				err = hooks.beforeCloseShard(ctx, shardID, shardDrained)
+				if stoppable, ok := c.group.(shardStopHandler); ok {
+					if stopErr := stoppable.ShardStopped(c.shutdown.drainContext(), shardID); stopErr != nil {
+						err = errors.Join(err, fmt.Errorf("shard stopped error: %w", stopErr))
+					}
+				}
+			} else {
+				stop := shardEnded
+				if ctx.Err() != nil {
+					stop = shardDrained
+				}
+				if err = hooks.beforeCloseShard(ctx, shardID, stop); err != nil {
+					// the shard is not finished
+				} else if closeable, ok := c.group.(CloseableGroup); !ok {
+					// group doesn't allow closure, skip calling CloseShard
+				} else if err = closeable.CloseShard(context.Background(), shardID); err != nil {
+					err = fmt.Errorf("shard closed CloseableGroup error: %w", err)
+				}
 			}
 			if err != nil {
 				select {
@@ -216,11 +375,31 @@ func (c *Consumer) Scan(ctx context.Context, fn ScanFunc) error {
 
 	go func() {
 		wg.Wait()
+		// stop the group, which may still be sending shards after Shutdown
+		cancel()
+		<-groupDone
 		close(errC)
 	}()
 
 	err := <-errC
-	return c.finishScan(err)
+	err = c.finishScan(err)
+	if deregisterErr := c.deregisterStreamConsumer(context.Background()); deregisterErr != nil {
+		if err == nil {
+			return deregisterErr
+		}
+		c.logger.Log("[CONSUMER] stream consumer deregister error:", deregisterErr)
+	}
+	return err
+}
+
+func (h shardHooks) beforeCloseShard(ctx context.Context, shardID string, stop shardStop) error {
+	if h.beforeClose == nil {
+		return nil
+	}
+	if err := h.beforeClose(ctx, shardID, stop); err != nil {
+		return fmt.Errorf("shard %s error: %w", shardID, err)
+	}
+	return nil
 }
 
 // ScanBatch scans all shards and delivers buffered records to a batch callback.
@@ -233,6 +412,9 @@ func (c *Consumer) ScanBatch(ctx context.Context, fn ScanBatchFunc, opts ...Scan
 	if fn == nil {
 		return errors.New("batch callback is required")
 	}
+	if c.partitionKeyConcurrency > 1 {
+		return errors.New("partition key concurrency is not supported with ScanBatch")
+	}
 
 	cfg := scanBatchConfig{
 		flushInterval: time.Second,
@@ -252,34 +434,54 @@ func (c *Consumer) ScanBatch(ctx context.Context, fn ScanBatchFunc, opts ...Scan
 // ScanShard loops over records on a specific shard, calls the callback func
 // for each record and checkpoints the progress of scan.
 func (c *Consumer) ScanShard(ctx context.Context, shardID string, fn ScanFunc) error {
-	err := c.scanShard(ctx, shardID, fn)
-	return c.finishScan(err)
-}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	scanID, ok := c.shutdown.startScan(cancel)
+	if !ok {
+		return nil
+	}
+	defer c.shutdown.endScan(scanID)
 
-func (c *Consumer) scanShard(ctx context.Context, shardID string, fn ScanFunc) error {
-	return newScanShardRunner(c, shardID, fn).run(ctx)
+	fn = recoverScanFunc(c.deadLetterScanFunc(ctx, c.applyMiddleware(fn)))
+	err := c.scanShardRecover(ctx, shardID, fn)
+	return c.finishScan(err)
 }
 
-func deaggregateRecords(in []types.Record) ([]types.Record, error) {
-	return deaggregator.DeaggregateRecords(in)
+// scanShardRecover returns a *PanicError if reading the shard panics.
+func (c *Consumer) scanShardRecover(ctx context.Context, shardID string, fn ScanFunc) (err error) {
+	c.shutdown.startShard(shardID)
+	defer c.shutdown.endShard(shardID)
+	defer func() {
+		if p := recover(); p != nil {
+			err = newPanicError(shardID, "", p)
+		}
+	}()
+	return c.scanShard(ctx, shardID, fn)
 }
 
-func (c *Consumer) normalizeRecords(records []types.Record) ([]types.Record, error) {
-	if !c.isAggregated {
-		return records, nil
+func (c *Consumer) scanShard(ctx context.Context, shardID string, fn ScanFunc) error {
+	if c.consumerARN != "" {
+		return newSubscribeShardRunner(c, shardID, fn).run(ctx)
 	}
-	return deaggregateRecords(records)
+	return newScanShardRunner(c, shardID, fn).run(ctx)
 }
 
 func (c *Consumer) processRecords(ctx context.Context, shardID string, records []types.Record, millisBehindLatest *int64, fn ScanFunc, lastSeqNum string) (string, error) {
-	for _, record := range records {
+	if c.partitionKeyConcurrency > 1 {
+		return c.processRecordsByPartitionKey(ctx, shardID, records, millisBehindLatest, fn, lastSeqNum)
+	}
+
+	page := c.shardRecords(records, lastSeqNum)
+	for i, record := range page {
 		select {
 		case <-ctx.Done():
 			return lastSeqNum, nil
 		default:
 		}
 
-		err := fn(&Record{record, shardID, millisBehindLatest})
+		r := c.newRecord(shardID, record, millisBehindLatest)
+		r.endOfPage = i == len(page)-1
+		err := fn(r)
 		if err != nil && !errors.Is(err, ErrSkipCheckpoint) {
 			return lastSeqNum, err
 		}
@@ -289,15 +491,27 @@ func (c *Consumer) processRecords(ctx context.Context, shardID string, records [
 			continue
 		}
 
-		if err := c.setCheckpointWithRetry(ctx, shardID, aws.ToString(record.SequenceNumber)); err != nil {
+		if err := c.setCheckpointWithRetry(ctx, shardID, record.checkpoint); err != nil {
 			return lastSeqNum, err
 		}
-		lastSeqNum = aws.ToString(record.SequenceNumber)
+		lastSeqNum = record.checkpoint
 		c.counter.Add("records", 1)
 	}
 	return lastSeqNum, nil
 }
 
+func (c *Consumer) newRecord(shardID string, record shardRecord, millisBehindLatest *int64) *Record {
+	return &Record{
+		Record:             record.Record,
+		ShardID:            shardID,
+		MillisBehindLatest: millisBehindLatest,
+		StreamName:         c.streamName,
+		SubSequenceNumber:  record.subSequenceNumber,
+		checkpoint:         record.checkpoint,
+		counter:            c.counter,
+	}
+}
+
 func (c *Consumer) getShardIteratorWithCheckpointFallback(ctx context.Context, streamName, shardID, seqNum string) (*string, string, error) {
 	shardIterator, err := c.getShardIterator(ctx, streamName, shardID, seqNum)
 	if err == nil {
@@ -316,15 +530,25 @@ func (c *Consumer) getShardIteratorWithCheckpointFallback(ctx context.Context, s
 	return shardIterator, "", nil
 }
 
-func (c *Consumer) getShardIterator(ctx context.Context, streamName, shardID, seqNum string) (*string, error) {
+func (c *Consumer) getShardIterator(ctx context.Context, stream, shardID, seqNum string) (*string, error) {
+	streamName, streamARN := streamParams(stream)
 	params := &kinesis.GetShardIteratorInput{
 		ShardId:    aws.String(shardID),
-		StreamName: aws.String(streamName),
+		StreamName: streamName,
+		StreamARN:  streamARN,
 	}
 
-	if seqNum != "" {
+	if seqNum, _, within := parseCheckpoint(seqNum); within {
+		// re-read the aggregate; records already processed are dropped
+		params.ShardIteratorType = types.ShardIteratorTypeAtSequenceNumber
+		params.StartingSequenceNumber = aws.String(seqNum)
+	} else if seqNum != "" {
 		params.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
 		params.StartingSequenceNumber = aws.String(seqNum)
+	} else if trimHorizon, err := c.startsAtTrimHorizon(ctx, shardID); err != nil {
+		return nil, err
+	} else if trimHorizon {
+		params.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
 	} else if c.initialTimestamp != nil {
 		params.ShardIteratorType = types.ShardIteratorTypeAtTimestamp
 		params.Timestamp = c.initialTimestamp
@@ -339,10 +563,12 @@ func (c *Consumer) getShardIterator(ctx context.Context, streamName, shardID, se
 	return res.ShardIterator, nil
 }
 
-func (c *Consumer) getTrimHorizonShardIterator(ctx context.Context, streamName, shardID string) (*string, error) {
+func (c *Consumer) getTrimHorizonShardIterator(ctx context.Context, stream, shardID string) (*string, error) {
+	streamName, streamARN := streamParams(stream)
 	res, err := c.client.GetShardIterator(ctx, &kinesis.GetShardIteratorInput{
 		ShardId:           aws.String(shardID),
-		StreamName:        aws.String(streamName),
+		StreamName:        streamName,
+		StreamARN:         streamARN,
 		ShardIteratorType: types.ShardIteratorTypeTrimHorizon,
 	})
 	if err != nil {
@@ -374,6 +600,18 @@ func (c *Consumer) setCheckpointWithRetry(ctx context.Context, shardID, sequence
 	return fmt.Errorf("checkpoint set error after retries: %w", err)
 }
 
+func (c *Consumer) handleShardClosed(shardID string) error {
+	c.logger.Log("[CONSUMER] shard closed:", shardID)
+
+	if c.shardClosedHandler == nil {
+		return nil
+	}
+	if err := c.shardClosedHandler(c.streamName, shardID); err != nil {
+		return fmt.Errorf("shard closed handler error: %w", err)
+	}
+	return nil
+}
+
 func (c *Consumer) finishScan(scanErr error) error {
 	if flushErr := c.flushCheckpoints(); flushErr != nil {
 		if scanErr == nil {
@@ -427,16 +665,19 @@ func retryDelay(err error, attempt int) time.Duration {
 	if oe := (*types.ProvisionedThroughputExceededException)(nil); !errors.As(err, &oe) {
 		return 0
 	}
+	return exponentialDelay(getRecordsRetryBaseDelay, getRecordsRetryMaxDelay, attempt)
+}
 
-	delay := getRecordsRetryBaseDelay
+func exponentialDelay(base, max time.Duration, attempt int) time.Duration {
+	delay := base
 	for i := 1; i < attempt; i++ {
-		if delay >= getRecordsRetryMaxDelay {
-			return getRecordsRetryMaxDelay
+		if delay >= max {
+			return max
 		}
 		delay *= 2
 	}
-	if delay > getRecordsRetryMaxDelay {
-		return getRecordsRetryMaxDelay
+	if delay > max {
+		return max
 	}
 	return delay
 }
@@ -213,7 +213,7 @@ func TestScanShard_FlushesBufferedCheckpointsBeforeReturning(t *testing.T) {
 	}
 }
 
-func TestAggregationCheckpointing_RestartsAfterWholeSequenceNumber(t *testing.T) {
+func TestAggregationCheckpointing_ResumesWithinAggregate(t *testing.T) {
 	cp := store.New()
 
 	c, err := New("myStreamName",
@@ -227,13 +227,14 @@ func TestAggregationCheckpointing_RestartsAfterWholeSequenceNumber(t *testing.T)
 	aggregatedRecords := []types.Record{
 		{SequenceNumber: aws.String("agg-seq"), Data: []byte("logical-1")},
 		{SequenceNumber: aws.String("agg-seq"), Data: []byte("logical-2")},
+		{SequenceNumber: aws.String("agg-seq"), Data: []byte("logical-3")},
 	}
 
 	calls := 0
 	_, err = c.processRecords(context.Background(), "myShard", aggregatedRecords, nil, func(r *Record) error {
 		calls++
-		if calls == 2 {
-			return errors.New("stop after checkpointing first logical record")
+		if calls == 3 {
+			return errors.New("stop after checkpointing two logical records")
 		}
 		return nil
 	}, "")
@@ -245,20 +246,23 @@ func TestAggregationCheckpointing_RestartsAfterWholeSequenceNumber(t *testing.T)
 	if err != nil {
 		t.Fatalf("GetCheckpoint() error = %v", err)
 	}
-	if checkpoint != "agg-seq" {
-		t.Fatalf("checkpoint = %q, want %q", checkpoint, "agg-seq")
+	if checkpoint != "agg-seq:1" {
+		t.Fatalf("checkpoint = %q, want %q", checkpoint, "agg-seq:1")
 	}
 
 	client := &kinesisClientMock{
 		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
-			if got := params.ShardIteratorType; got != types.ShardIteratorTypeAfterSequenceNumber {
-				t.Fatalf("ShardIteratorType = %q, want %q", got, types.ShardIteratorTypeAfterSequenceNumber)
+			if got := params.ShardIteratorType; got != types.ShardIteratorTypeAtSequenceNumber {
+				t.Fatalf("ShardIteratorType = %q, want %q", got, types.ShardIteratorTypeAtSequenceNumber)
 			}
 			if got := aws.ToString(params.StartingSequenceNumber); got != "agg-seq" {
 				t.Fatalf("StartingSequenceNumber = %q, want %q", got, "agg-seq")
 			}
 			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("next-iterator")}, nil
 		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			return &kinesis.GetRecordsOutput{Records: aggregatedRecords}, nil
+		},
 	}
 
 	resumeConsumer, err := New("myStreamName",
@@ -270,15 +274,42 @@ func TestAggregationCheckpointing_RestartsAfterWholeSequenceNumber(t *testing.T)
 		t.Fatalf("new resume consumer error: %v", err)
 	}
 
-	iterator, resumedSeq, err := resumeConsumer.getShardIteratorWithCheckpointFallback(context.Background(), "myStreamName", "myShard", checkpoint)
-	if err != nil {
-		t.Fatalf("getShardIteratorWithCheckpointFallback() error = %v", err)
+	var resumed []string
+	if err := resumeConsumer.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		resumed = append(resumed, fmt.Sprintf("%s/%d", r.Data, r.SubSequenceNumber))
+		return nil
+	}); err != nil {
+		t.Fatalf("scan shard error: %v", err)
 	}
-	if aws.ToString(iterator) != "next-iterator" {
-		t.Fatalf("iterator = %q, want %q", aws.ToString(iterator), "next-iterator")
+
+	if got := fmt.Sprint(resumed); got != "[logical-3/2]" {
+		t.Fatalf("resumed records = %s, want [logical-3/2]", got)
 	}
-	if resumedSeq != "agg-seq" {
-		t.Fatalf("resumedSeq = %q, want %q", resumedSeq, "agg-seq")
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "agg-seq" {
+		t.Fatalf("checkpoint after aggregate = %q, want %q", val, "agg-seq")
+	}
+}
+
+func TestShardRecords_SubSequenceCheckpoints(t *testing.T) {
+	c := &Consumer{isAggregated: true}
+	page := []types.Record{
+		{SequenceNumber: aws.String("seq-1")},
+		{SequenceNumber: aws.String("seq-2")},
+		{SequenceNumber: aws.String("seq-2")},
+		{SequenceNumber: aws.String("seq-3")},
+	}
+
+	var got []string
+	for _, r := range c.shardRecords(page, "") {
+		got = append(got, r.checkpoint)
+	}
+	if want := "[seq-1 seq-2:0 seq-2 seq-3]"; fmt.Sprint(got) != want {
+		t.Fatalf("checkpoints = %v, want %s", got, want)
+	}
+
+	c.isAggregated = false
+	if records := c.shardRecords(page, "seq-2:0"); len(records) != 3 || records[1].subSequenceNumber != 1 {
+		t.Fatalf("resume within aggregate kept %d records, want 3 with sub-sequence 1 second", len(records))
 	}
 }
 
@@ -2245,3 +2276,64 @@ func TestScan_ParentChildOrdering(t *testing.T) {
 		t.Errorf("checkout error expected %s, got %s", "shard4num", val)
 	}
 }
+
+func TestNewFromARN_AddressesStreamByARN(t *testing.T) {
+	const streamARN = "arn:aws:kinesis:us-east-1:123456789012:stream/myStreamName"
+
+	client := &kinesisClientMock{
+		listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+			if aws.ToString(params.StreamARN) != streamARN || params.StreamName != nil {
+				t.Errorf("ListShards input = name:%q arn:%q, want arn only", aws.ToString(params.StreamName), aws.ToString(params.StreamARN))
+			}
+			return &kinesis.ListShardsOutput{
+				Shards: []types.Shard{{ShardId: aws.String("myShard")}},
+			}, nil
+		},
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			if aws.ToString(params.StreamARN) != streamARN || params.StreamName != nil {
+				t.Errorf("GetShardIterator input = name:%q arn:%q, want arn only", aws.ToString(params.StreamName), aws.ToString(params.StreamARN))
+			}
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			if aws.ToString(params.StreamARN) != streamARN {
+				t.Errorf("GetRecords StreamARN = %q, want %q", aws.ToString(params.StreamARN), streamARN)
+			}
+			return &kinesis.GetRecordsOutput{Records: records}, nil
+		},
+	}
+
+	cp := store.New()
+	c, err := NewFromARN(streamARN, WithClient(client), WithStore(cp))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Scan(ctx, func(r *Record) error {
+		if aws.ToString(r.SequenceNumber) == "lastSeqNum" {
+			cancel()
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("scan returned unexpected error %v", err)
+	}
+
+	if val, _ := cp.GetCheckpoint(streamARN, "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint keyed by ARN = %q, want %q", val, "lastSeqNum")
+	}
+}
+
+func TestNewFromARN_InvalidARN(t *testing.T) {
+	for _, arn := range []string{
+		"myStreamName",
+		"arn:aws:sqs:us-east-1:123456789012:queue",
+		"arn:aws:kinesis:us-east-1:123456789012:stream/",
+		"arn:aws:kinesis:us-east-1:123456789012:stream/name/consumer/app:1",
+	} {
+		if _, err := NewFromARN(arn, WithClient(&kinesisClientMock{})); err == nil {
+			t.Errorf("NewFromARN(%q) expected error", arn)
+		}
+	}
+}
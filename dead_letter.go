@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	deadLetterDefaultMaxAttempts = 3
+	deadLetterDefaultRetryDelay  = 100 * time.Millisecond
+	deadLetterRetryMaxDelay      = 5 * time.Second
+)
+
+// DeadLetter describes a record the callback failed to process. The shard,
+// stream and sequence number are available on Record.
+type DeadLetter struct {
+	Record   *Record
+	Err      error
+	Attempts int
+}
+
+// DeadLetterSink receives records that still fail after all retry attempts.
+// If Put returns an error the record is not checkpointed and scanning stops.
+type DeadLetterSink interface {
+	Put(ctx context.Context, dl DeadLetter) error
+}
+
+// DeadLetterOption customizes dead-letter handling.
+type DeadLetterOption func(*deadLetterConfig)
+
+type deadLetterConfig struct {
+	sink        DeadLetterSink
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// WithDeadLetterMaxAttempts sets how many times the callback is called for a
+// record before it is dead-lettered. The default is 3.
+func WithDeadLetterMaxAttempts(n int) DeadLetterOption {
+	return func(cfg *deadLetterConfig) {
+		cfg.maxAttempts = n
+	}
+}
+
+// WithDeadLetterRetryDelay sets the delay before the first retry. The delay
+// doubles on each further attempt, up to 5 seconds.
+func WithDeadLetterRetryDelay(d time.Duration) DeadLetterOption {
+	return func(cfg *deadLetterConfig) {
+		cfg.retryDelay = d
+	}
+}
+
+// deadLetterScanFunc wraps fn so a failing record is retried and then handed to
+// the dead-letter sink, letting the scan continue. It returns fn unchanged when
+// no sink is configured.
+func (c *Consumer) deadLetterScanFunc(ctx context.Context, fn ScanFunc) ScanFunc {
+	cfg := c.deadLetter
+	if cfg == nil {
+		return fn
+	}
+
+	return func(r *Record) error {
+		var err error
+		attempt := 1
+		for ; ; attempt++ {
+			err = fn(r)
+			if err == nil || errors.Is(err, ErrSkipCheckpoint) {
+				return err
+			}
+			if attempt >= cfg.maxAttempts {
+				break
+			}
+			c.logger.Log("[CONSUMER] record retry:", r.ShardID, aws.ToString(r.SequenceNumber), attempt, err)
+			if !c.retryWait(ctx, exponentialDelay(cfg.retryDelay, deadLetterRetryMaxDelay, attempt)) {
+				// shutting down; leave the record to be read again
+				return ErrSkipCheckpoint
+			}
+		}
+
+		if sinkErr := cfg.sink.Put(ctx, DeadLetter{Record: r, Err: err, Attempts: attempt}); sinkErr != nil {
+			return fmt.Errorf("dead letter error: %w", errors.Join(sinkErr, err))
+		}
+		c.logger.Log("[CONSUMER] record dead-lettered:", r.ShardID, aws.ToString(r.SequenceNumber), err)
+		c.counter.Add("dead_letters", 1)
+		r.deadLettered = true
+		return nil
+	}
+}
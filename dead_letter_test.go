@@ -0,0 +1,239 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+type deadLetterSinkMock struct {
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+	err         error
+}
+
+func (s *deadLetterSinkMock) Put(ctx context.Context, dl DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.deadLetters = append(s.deadLetters, dl)
+	return nil
+}
+
+type namedCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *namedCounter) Add(name string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]int64)
+	}
+	c.counts[name] += n
+}
+
+func (c *namedCounter) Get(name string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[name]
+}
+
+func TestScanShard_DeadLetterRetriesThenContinues(t *testing.T) {
+	var (
+		sink = &deadLetterSinkMock{}
+		cp   = store.New()
+		ctr  = &namedCounter{}
+	)
+	c, err := New("myStreamName",
+		WithClient(newSingleShardClient()),
+		WithStore(cp),
+		WithCounter(ctr),
+		WithDeadLetter(sink, WithDeadLetterMaxAttempts(3), WithDeadLetterRetryDelay(time.Millisecond)),
+	)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	var waits []time.Duration
+	c.retryWait = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	badPayload := errors.New("bad payload")
+	var attempts int
+	err = c.ScanShard(ctx, "myShard", func(r *Record) error {
+		if string(r.Data) == "firstData" {
+			attempts++
+			return badPayload
+		}
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+	if len(waits) != 2 || waits[0] != time.Millisecond || waits[1] != 2*time.Millisecond {
+		t.Fatalf("retry waits = %v, want [1ms 2ms]", waits)
+	}
+	if len(sink.deadLetters) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(sink.deadLetters))
+	}
+	dl := sink.deadLetters[0]
+	if !errors.Is(dl.Err, badPayload) || dl.Attempts != 3 || dl.Record.ShardID != "myShard" || aws.ToString(dl.Record.SequenceNumber) != "firstSeqNum" {
+		t.Fatalf("unexpected dead letter: %+v", dl)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want %q", val, "lastSeqNum")
+	}
+	if got := ctr.Get("dead_letters"); got != 1 {
+		t.Fatalf("dead letter count = %d, want 1", got)
+	}
+}
+
+func TestScanShard_DeadLetterSinkErrorStopsScan(t *testing.T) {
+	sinkErr := errors.New("sink unavailable")
+	cp := store.New()
+	c, err := New("myStreamName",
+		WithClient(newSingleShardClient()),
+		WithStore(cp),
+		WithDeadLetter(&deadLetterSinkMock{err: sinkErr}, WithDeadLetterMaxAttempts(1)),
+	)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	err = c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		return errors.New("bad payload")
+	})
+	if !errors.Is(err, sinkErr) {
+		t.Fatalf("scan shard error = %v, want %v", err, sinkErr)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "" {
+		t.Fatalf("checkpoint = %q, want none", val)
+	}
+}
+
+func TestScan_DeadLetterRetryStopsWhenAnotherShardFails(t *testing.T) {
+	shardErr := &types.ResourceNotFoundException{Message: aws.String("shard gone")}
+	retrying := make(chan struct{})
+	var once sync.Once
+	client := &kinesisClientMock{
+		listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+			return &kinesis.ListShardsOutput{Shards: []types.Shard{
+				{ShardId: aws.String("goodShard")},
+				{ShardId: aws.String("badShard")},
+			}}, nil
+		},
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: params.ShardId}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			if aws.ToString(params.ShardIterator) == "badShard" {
+				<-retrying
+				return nil, shardErr
+			}
+			return &kinesis.GetRecordsOutput{NextShardIterator: aws.String("goodShard"), Records: records}, nil
+		},
+	}
+
+	sink := &deadLetterSinkMock{}
+	c, err := New("myStreamName", WithClient(client), WithDeadLetter(sink))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	retryCancelled := make(chan struct{}, 1)
+	c.retryWait = func(ctx context.Context, d time.Duration) bool {
+		once.Do(func() { close(retrying) })
+		select {
+		case <-ctx.Done():
+			retryCancelled <- struct{}{}
+		case <-time.After(2 * time.Second):
+		}
+		return false
+	}
+
+	err = c.Scan(context.Background(), func(r *Record) error {
+		return errors.New("bad payload")
+	})
+	if !errors.Is(err, shardErr) {
+		t.Fatalf("scan error = %v, want %v", err, shardErr)
+	}
+
+	select {
+	case <-retryCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("dead letter retry was not cancelled when the scan stopped")
+	}
+	if len(sink.deadLetters) != 0 {
+		t.Fatalf("dead letters = %d, want none after the scan stopped", len(sink.deadLetters))
+	}
+}
+
+func TestScanAck_DeadLetteredRecordIsAcknowledged(t *testing.T) {
+	sink := &deadLetterSinkMock{}
+	cp := store.New()
+	c, err := New("myStreamName",
+		WithClient(newSingleShardClient()),
+		WithStore(cp),
+		WithDeadLetter(sink, WithDeadLetterMaxAttempts(1)),
+	)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	delivered := make(chan *Record, len(records))
+	errC := make(chan error, 1)
+	go func() {
+		errC <- c.ScanAck(ctx, func(r *Record) error {
+			if string(r.Data) == "firstData" {
+				return errors.New("bad payload")
+			}
+			delivered <- r
+			return nil
+		}, WithMaxUnackedRecords(1))
+	}()
+
+	// the second record only gets a slot once the dead-lettered one is acked
+	select {
+	case r := <-delivered:
+		r.Ack()
+	case <-time.After(5 * time.Second):
+		t.Fatal("record after the dead-lettered one was not delivered")
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want %q", val, "lastSeqNum")
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("scan ack error: %v", err)
+	}
+	if len(sink.deadLetters) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(sink.deadLetters))
+	}
+}
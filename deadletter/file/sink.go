@@ -0,0 +1,85 @@
+// The file sink appends dead letters to a local file as JSON lines, one object
+// per record, so failed payloads can be inspected or replayed later.
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	consumer "github.com/harlow/kinesis-consumer"
+)
+
+// Entry is the JSON representation of a dead letter written to the file.
+type Entry struct {
+	StreamName        string    `json:"stream_name"`
+	ShardID           string    `json:"shard_id"`
+	SequenceNumber    string    `json:"sequence_number"`
+	SubSequenceNumber int64     `json:"sub_sequence_number,omitempty"`
+	PartitionKey      string    `json:"partition_key"`
+	Data              []byte    `json:"data"`
+	Error             string    `json:"error"`
+	Attempts          int       `json:"attempts"`
+	Time              time.Time `json:"time"`
+}
+
+// New opens path for appending, creating it if needed.
+func New(path string) (*Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter file: %w", err)
+	}
+	return &Sink{file: f}, nil
+}
+
+type Sink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Put appends the dead letter and syncs the file, so a checkpoint is never
+// written for a record that is not on disk.
+func (s *Sink) Put(_ context.Context, dl consumer.DeadLetter) error {
+	entry := Entry{
+		Attempts: dl.Attempts,
+		Time:     time.Now().UTC(),
+	}
+	if dl.Err != nil {
+		entry.Error = dl.Err.Error()
+	}
+	if r := dl.Record; r != nil {
+		entry.StreamName = r.StreamName
+		entry.ShardID = r.ShardID
+		entry.SequenceNumber = aws.ToString(r.SequenceNumber)
+		entry.SubSequenceNumber = r.SubSequenceNumber
+		entry.PartitionKey = aws.ToString(r.PartitionKey)
+		entry.Data = r.Data
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the underlying file.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,66 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	consumer "github.com/harlow/kinesis-consumer"
+)
+
+func Test_PutAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("new sink error: %v", err)
+	}
+
+	for _, seq := range []string{"seq1", "seq2"} {
+		err := s.Put(context.Background(), consumer.DeadLetter{
+			Record: &consumer.Record{
+				Record:     types.Record{SequenceNumber: aws.String(seq), Data: []byte("payload")},
+				ShardID:    "shardID",
+				StreamName: "streamName",
+			},
+			Err:      errors.New("bad payload"),
+			Attempts: 3,
+		})
+		if err != nil {
+			t.Fatalf("put error: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("entries expected %d, got %d", 2, len(entries))
+	}
+	e := entries[1]
+	if e.SequenceNumber != "seq2" || e.ShardID != "shardID" || e.Error != "bad payload" || string(e.Data) != "payload" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+}
@@ -0,0 +1,37 @@
+// The memory sink keeps dead letters in memory. It is intended for tests and
+// for applications that inspect failures in-process; nothing survives a restart.
+package deadletter
+
+import (
+	"context"
+	"sync"
+
+	consumer "github.com/harlow/kinesis-consumer"
+)
+
+func New() *Sink {
+	return &Sink{}
+}
+
+type Sink struct {
+	mu          sync.Mutex
+	deadLetters []consumer.DeadLetter
+}
+
+func (s *Sink) Put(_ context.Context, dl consumer.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadLetters = append(s.deadLetters, dl)
+	return nil
+}
+
+// DeadLetters returns a copy of the dead letters received so far.
+func (s *Sink) DeadLetters() []consumer.DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]consumer.DeadLetter, len(s.deadLetters))
+	copy(out, s.deadLetters)
+	return out
+}
@@ -0,0 +1,30 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	consumer "github.com/harlow/kinesis-consumer"
+)
+
+func Test_PutAndList(t *testing.T) {
+	s := New()
+
+	err := s.Put(context.Background(), consumer.DeadLetter{
+		Record:   &consumer.Record{ShardID: "shardID"},
+		Err:      errors.New("bad payload"),
+		Attempts: 3,
+	})
+	if err != nil {
+		t.Fatalf("put error: %v", err)
+	}
+
+	dls := s.DeadLetters()
+	if len(dls) != 1 {
+		t.Fatalf("dead letters expected %d, got %d", 1, len(dls))
+	}
+	if dls[0].Record.ShardID != "shardID" || dls[0].Attempts != 3 {
+		t.Fatalf("unexpected dead letter: %+v", dls[0])
+	}
+}
@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"google.golang.org/protobuf/proto"
+)
+
+// Decoder turns the data of a record into a value of type T.
+type Decoder[T any] interface {
+	Decode(data []byte) (T, error)
+}
+
+// DecoderFunc adapts a function to a Decoder.
+type DecoderFunc[T any] func(data []byte) (T, error)
+
+func (f DecoderFunc[T]) Decode(data []byte) (T, error) {
+	return f(data)
+}
+
+// JSONDecoder decodes record data as JSON into a T.
+type JSONDecoder[T any] struct{}
+
+func (JSONDecoder[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// ProtoDecoder decodes record data as a protobuf message. T is the generated
+// message pointer type, e.g. ProtoDecoder[*pb.Event].
+type ProtoDecoder[T proto.Message] struct{}
+
+func (ProtoDecoder[T]) Decode(data []byte) (T, error) {
+	var zero T
+	v := zero.ProtoReflect().New().Interface().(T)
+	if err := proto.Unmarshal(data, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// RawDecoder passes record data through unchanged.
+type RawDecoder struct{}
+
+func (RawDecoder) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// DecodeErrorPolicy is what ScanTyped does with a record that fails to decode.
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorFail stops the scan with the decode error.
+	DecodeErrorFail DecodeErrorPolicy = iota
+	// DecodeErrorSkip drops the record and checkpoints past it.
+	DecodeErrorSkip
+	// DecodeErrorSkipCheckpoint drops the record without checkpointing it,
+	// as if the callback returned ErrSkipCheckpoint.
+	DecodeErrorSkipCheckpoint
+)
+
+// ScanTypedOption customizes ScanTyped.
+type ScanTypedOption func(*scanTypedConfig)
+
+type scanTypedConfig struct {
+	decodeErrorPolicy DecodeErrorPolicy
+}
+
+// WithDecodeErrorPolicy sets how records that fail to decode are handled. The
+// default is DecodeErrorFail.
+func WithDecodeErrorPolicy(p DecodeErrorPolicy) ScanTypedOption {
+	return func(cfg *scanTypedConfig) {
+		cfg.decodeErrorPolicy = p
+	}
+}
+
+// Scanner is implemented by Consumer and MultiStreamConsumer.
+type Scanner interface {
+	Scan(ctx context.Context, fn ScanFunc) error
+}
+
+// ScanTyped scans with s and calls fn with each record and its data decoded by
+// dec. Errors returned by fn, including ErrSkipCheckpoint, behave as with Scan.
+func ScanTyped[T any](ctx context.Context, s Scanner, dec Decoder[T], fn func(*Record, T) error, opts ...ScanTypedOption) error {
+	if dec == nil || fn == nil {
+		return errors.New("decoder and callback are required")
+	}
+
+	cfg := scanTypedConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return s.Scan(ctx, func(r *Record) error {
+		v, err := dec.Decode(r.Data)
+		if err == nil {
+			return fn(r, v)
+		}
+
+		switch cfg.decodeErrorPolicy {
+		case DecodeErrorSkip:
+			return nil
+		case DecodeErrorSkipCheckpoint:
+			return ErrSkipCheckpoint
+		default:
+			return fmt.Errorf("decode record %s: %w", aws.ToString(r.SequenceNumber), err)
+		}
+	})
+}
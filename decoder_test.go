@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func TestDecoders(t *testing.T) {
+	type event struct {
+		ID int `json:"id"`
+	}
+	if v, err := (JSONDecoder[event]{}).Decode([]byte(`{"id":7}`)); err != nil || v.ID != 7 {
+		t.Fatalf("json decode = %+v, %v", v, err)
+	}
+	if _, err := (JSONDecoder[event]{}).Decode([]byte(`{`)); err == nil {
+		t.Fatal("expected json decode error")
+	}
+
+	data, err := proto.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	if v, err := (ProtoDecoder[*wrapperspb.StringValue]{}).Decode(data); err != nil || v.GetValue() != "hello" {
+		t.Fatalf("proto decode = %v, %v", v, err)
+	}
+
+	if v, err := (RawDecoder{}).Decode([]byte("raw")); err != nil || string(v) != "raw" {
+		t.Fatalf("raw decode = %q, %v", v, err)
+	}
+}
+
+func TestScanTyped_DecodeErrorPolicy(t *testing.T) {
+	page := []types.Record{
+		{Data: []byte(`{"id":1}`), SequenceNumber: aws.String("seq-1")},
+		{Data: []byte(`not json`), SequenceNumber: aws.String("seq-2")},
+	}
+	type event struct {
+		ID int `json:"id"`
+	}
+
+	tests := []struct {
+		policy         DecodeErrorPolicy
+		wantErr        bool
+		wantCheckpoint string
+	}{
+		{DecodeErrorFail, true, "seq-1"},
+		{DecodeErrorSkip, false, "seq-2"},
+		{DecodeErrorSkipCheckpoint, false, "seq-1"},
+	}
+	for _, tt := range tests {
+		client := &kinesisClientMock{
+			getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+				return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter")}, nil
+			},
+			getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+				return &kinesis.GetRecordsOutput{Records: page}, nil
+			},
+		}
+		cp := store.New()
+		c, err := New("myStreamName", WithClient(client), WithStore(cp))
+		if err != nil {
+			t.Fatalf("new consumer error: %v", err)
+		}
+
+		// read the single shard to its end through ScanShard
+		shard := scannerFunc(func(ctx context.Context, fn ScanFunc) error {
+			return c.ScanShard(ctx, "myShard", fn)
+		})
+
+		var ids []int
+		err = ScanTyped(context.Background(), shard, JSONDecoder[event]{}, func(r *Record, e event) error {
+			ids = append(ids, e.ID)
+			return nil
+		}, WithDecodeErrorPolicy(tt.policy))
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("policy %d: scan error = %v, want error %v", tt.policy, err, tt.wantErr)
+		}
+		if tt.wantErr && !errors.As(err, new(*json.SyntaxError)) {
+			t.Fatalf("policy %d: error = %v, want wrapped *json.SyntaxError", tt.policy, err)
+		}
+		if len(ids) != 1 || ids[0] != 1 {
+			t.Fatalf("policy %d: decoded ids = %v, want [1]", tt.policy, ids)
+		}
+		if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != tt.wantCheckpoint {
+			t.Fatalf("policy %d: checkpoint = %q, want %q", tt.policy, val, tt.wantCheckpoint)
+		}
+	}
+}
+
+type scannerFunc func(ctx context.Context, fn ScanFunc) error
+
+func (f scannerFunc) Scan(ctx context.Context, fn ScanFunc) error {
+	return f(ctx, fn)
+}
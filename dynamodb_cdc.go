@@ -0,0 +1,196 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBEventName is the kind of change a DynamoDB change event describes.
+type DynamoDBEventName string
+
+const (
+	DynamoDBInsert DynamoDBEventName = "INSERT"
+	DynamoDBModify DynamoDBEventName = "MODIFY"
+	DynamoDBRemove DynamoDBEventName = "REMOVE"
+)
+
+// DynamoDBChangeEvent is an item-level change written to the stream by Kinesis
+// Data Streams for DynamoDB, with its key and images unmarshalled into a T.
+type DynamoDBChangeEvent[T any] struct {
+	EventID   string
+	EventName DynamoDBEventName
+	TableName string
+	AWSRegion string
+	// ApproximateCreationTime is when the change was made.
+	ApproximateCreationTime time.Time
+	// Keys holds the key attributes of the changed item; other fields of T
+	// are left zero.
+	Keys T
+	// NewImage is the item after the change. It is nil for REMOVE events and
+	// when the table's stream view type does not include new images.
+	NewImage *T
+	// OldImage is the item before the change. It is nil for INSERT events and
+	// when the table's stream view type does not include old images.
+	OldImage *T
+}
+
+// DynamoDBChangeDecoder decodes Kinesis Data Streams for DynamoDB records.
+// Attribute values are unmarshalled into T with the attributevalue package,
+// so T uses `dynamodbav` struct tags as for GetItem results.
+type DynamoDBChangeDecoder[T any] struct{}
+
+type dynamoDBChangeRecord struct {
+	AWSRegion string `json:"awsRegion"`
+	EventID   string `json:"eventID"`
+	EventName string `json:"eventName"`
+	TableName string `json:"tableName"`
+	DynamoDB  struct {
+		ApproximateCreationDateTime          int64                      `json:"ApproximateCreationDateTime"`
+		ApproximateCreationDateTimePrecision string                     `json:"ApproximateCreationDateTimePrecision"`
+		Keys                                 map[string]json.RawMessage `json:"Keys"`
+		NewImage                             map[string]json.RawMessage `json:"NewImage"`
+		OldImage                             map[string]json.RawMessage `json:"OldImage"`
+	} `json:"dynamodb"`
+}
+
+func (DynamoDBChangeDecoder[T]) Decode(data []byte) (DynamoDBChangeEvent[T], error) {
+	var (
+		ev  DynamoDBChangeEvent[T]
+		rec dynamoDBChangeRecord
+	)
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return ev, err
+	}
+
+	ev.EventID = rec.EventID
+	ev.EventName = DynamoDBEventName(rec.EventName)
+	ev.TableName = rec.TableName
+	ev.AWSRegion = rec.AWSRegion
+	switch ev.EventName {
+	case DynamoDBInsert, DynamoDBModify, DynamoDBRemove:
+	default:
+		return ev, fmt.Errorf("unknown event name %q", rec.EventName)
+	}
+
+	if ts := rec.DynamoDB.ApproximateCreationDateTime; rec.DynamoDB.ApproximateCreationDateTimePrecision == "MICROSECOND" {
+		ev.ApproximateCreationTime = time.UnixMicro(ts)
+	} else {
+		ev.ApproximateCreationTime = time.UnixMilli(ts)
+	}
+
+	if err := unmarshalDynamoDBImage(rec.DynamoDB.Keys, &ev.Keys); err != nil {
+		return ev, fmt.Errorf("keys: %w", err)
+	}
+	var err error
+	if ev.NewImage, err = decodeDynamoDBImage[T](rec.DynamoDB.NewImage); err != nil {
+		return ev, fmt.Errorf("new image: %w", err)
+	}
+	if ev.OldImage, err = decodeDynamoDBImage[T](rec.DynamoDB.OldImage); err != nil {
+		return ev, fmt.Errorf("old image: %w", err)
+	}
+	return ev, nil
+}
+
+// decodeDynamoDBImage returns nil when the image is absent.
+func decodeDynamoDBImage[T any](image map[string]json.RawMessage) (*T, error) {
+	if image == nil {
+		return nil, nil
+	}
+	v := new(T)
+	if err := unmarshalDynamoDBImage(image, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func unmarshalDynamoDBImage(image map[string]json.RawMessage, out any) error {
+	item, err := attributeValueMapFromJSON(image)
+	if err != nil {
+		return err
+	}
+	return attributevalue.UnmarshalMap(item, out)
+}
+
+func attributeValueMapFromJSON(m map[string]json.RawMessage) (map[string]ddbtypes.AttributeValue, error) {
+	item := make(map[string]ddbtypes.AttributeValue, len(m))
+	for name, raw := range m {
+		av, err := attributeValueFromJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", name, err)
+		}
+		item[name] = av
+	}
+	return item, nil
+}
+
+// attributeValueFromJSON converts an attribute value in the DynamoDB JSON wire
+// form, e.g. {"S":"abc"}, to its SDK type.
+func attributeValueFromJSON(raw json.RawMessage) (ddbtypes.AttributeValue, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("want a single type descriptor, got %d", len(typed))
+	}
+
+	for typ, v := range typed {
+		switch typ {
+		case "S":
+			av := &ddbtypes.AttributeValueMemberS{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "N":
+			av := &ddbtypes.AttributeValueMemberN{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "B":
+			av := &ddbtypes.AttributeValueMemberB{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "BOOL":
+			av := &ddbtypes.AttributeValueMemberBOOL{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "NULL":
+			av := &ddbtypes.AttributeValueMemberNULL{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "SS":
+			av := &ddbtypes.AttributeValueMemberSS{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "NS":
+			av := &ddbtypes.AttributeValueMemberNS{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "BS":
+			av := &ddbtypes.AttributeValueMemberBS{}
+			return av, json.Unmarshal(v, &av.Value)
+		case "M":
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(v, &m); err != nil {
+				return nil, err
+			}
+			item, err := attributeValueMapFromJSON(m)
+			if err != nil {
+				return nil, err
+			}
+			return &ddbtypes.AttributeValueMemberM{Value: item}, nil
+		case "L":
+			var l []json.RawMessage
+			if err := json.Unmarshal(v, &l); err != nil {
+				return nil, err
+			}
+			list := make([]ddbtypes.AttributeValue, len(l))
+			for i, raw := range l {
+				av, err := attributeValueFromJSON(raw)
+				if err != nil {
+					return nil, fmt.Errorf("element %d: %w", i, err)
+				}
+				list[i] = av
+			}
+			return &ddbtypes.AttributeValueMemberL{Value: list}, nil
+		default:
+			return nil, fmt.Errorf("unknown type descriptor %q", typ)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,91 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+type dynamoDBOrder struct {
+	ID     string            `dynamodbav:"id"`
+	Total  float64           `dynamodbav:"total"`
+	Paid   bool              `dynamodbav:"paid"`
+	Tags   []string          `dynamodbav:"tags,stringset"`
+	Items  []map[string]int  `dynamodbav:"items"`
+	Labels map[string]string `dynamodbav:"labels"`
+	Note   *string           `dynamodbav:"note"`
+	Blob   []byte            `dynamodbav:"blob"`
+}
+
+func TestDynamoDBChangeDecoder(t *testing.T) {
+	dec := DynamoDBChangeDecoder[dynamoDBOrder]{}
+
+	modify := []byte(`{
+		"awsRegion": "us-east-1",
+		"eventID": "evt-1",
+		"eventName": "MODIFY",
+		"tableName": "orders",
+		"dynamodb": {
+			"ApproximateCreationDateTime": 1700000000123,
+			"Keys": {"id": {"S": "o-1"}},
+			"NewImage": {
+				"id": {"S": "o-1"},
+				"total": {"N": "12.5"},
+				"paid": {"BOOL": true},
+				"tags": {"SS": ["a", "b"]},
+				"items": {"L": [{"M": {"qty": {"N": "2"}}}]},
+				"labels": {"M": {"channel": {"S": "web"}}},
+				"note": {"NULL": true},
+				"blob": {"B": "aGk="}
+			},
+			"OldImage": {"id": {"S": "o-1"}, "total": {"N": "10"}, "paid": {"BOOL": false}}
+		}
+	}`)
+	ev, err := dec.Decode(modify)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if ev.EventName != DynamoDBModify || ev.TableName != "orders" || ev.EventID != "evt-1" || ev.AWSRegion != "us-east-1" {
+		t.Fatalf("event = %+v", ev)
+	}
+	if !ev.ApproximateCreationTime.Equal(time.UnixMilli(1700000000123)) {
+		t.Fatalf("creation time = %v", ev.ApproximateCreationTime)
+	}
+	if ev.Keys.ID != "o-1" || ev.Keys.Total != 0 {
+		t.Fatalf("keys = %+v, want only the key set", ev.Keys)
+	}
+	n := ev.NewImage
+	if n == nil || n.Total != 12.5 || !n.Paid || len(n.Tags) != 2 || n.Items[0]["qty"] != 2 ||
+		n.Labels["channel"] != "web" || n.Note != nil || string(n.Blob) != "hi" {
+		t.Fatalf("new image = %+v", n)
+	}
+	if ev.OldImage == nil || ev.OldImage.Total != 10 || ev.OldImage.Paid {
+		t.Fatalf("old image = %+v", ev.OldImage)
+	}
+
+	remove := []byte(`{"eventName": "REMOVE", "dynamodb": {
+		"ApproximateCreationDateTime": 1700000000123456,
+		"ApproximateCreationDateTimePrecision": "MICROSECOND",
+		"Keys": {"id": {"S": "o-1"}}
+	}}`)
+	ev, err = dec.Decode(remove)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if ev.EventName != DynamoDBRemove || ev.NewImage != nil || ev.OldImage != nil || ev.Keys.ID != "o-1" {
+		t.Fatalf("remove event = %+v", ev)
+	}
+	if !ev.ApproximateCreationTime.Equal(time.UnixMicro(1700000000123456)) {
+		t.Fatalf("creation time = %v", ev.ApproximateCreationTime)
+	}
+
+	for name, data := range map[string]string{
+		"bad json":       `{`,
+		"unknown event":  `{"eventName": "UPSERT"}`,
+		"bad descriptor": `{"eventName": "INSERT", "dynamodb": {"NewImage": {"id": {"X": "1"}}}}`,
+		"bad number":     `{"eventName": "INSERT", "dynamodb": {"NewImage": {"total": {"N": "abc"}}}}`,
+	} {
+		if _, err := dec.Decode([]byte(data)); err == nil {
+			t.Fatalf("%s: expected decode error", name)
+		}
+	}
+}
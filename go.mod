@@ -12,9 +12,11 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/kinesis v1.43.2
 	github.com/awslabs/kinesis-aggregation/go/v2 v2.0.0-20241004223953-c2774b1ab29b
 	github.com/go-sql-driver/mysql v1.9.3
+	github.com/klauspost/compress v1.18.0
 	github.com/lib/pq v1.11.2
 	github.com/pkg/errors v0.9.1
 	github.com/redis/go-redis/v9 v9.18.0
+	google.golang.org/protobuf v1.33.0
 )
 
 require (
@@ -40,7 +42,6 @@ require (
 	github.com/stretchr/testify v1.11.1 // indirect
 	github.com/yuin/gopher-lua v1.1.1 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
 )
 
 go 1.24
@@ -12,6 +12,7 @@ type GroupConfig struct {
 	GroupName       string // preferred
 	AppName         string // deprecated alias for GroupName
 	StreamName      string
+	StreamARN       string // preferred over StreamName; required for cross-account streams
 	WorkerID        string
 	KinesisClient   consumergroup.KinesisClient
 	Repository      Config // dynamodb client + lease table
@@ -39,6 +40,7 @@ func NewGroup(cfg GroupConfig) (*consumergroup.Group, error) {
 		GroupName:          cfg.GroupName,
 		AppName:            cfg.AppName,
 		StreamName:         cfg.StreamName,
+		StreamARN:          cfg.StreamARN,
 		WorkerID:           cfg.WorkerID,
 		KinesisClient:      cfg.KinesisClient,
 		Repository:         repo,
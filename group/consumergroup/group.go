@@ -6,7 +6,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -59,6 +61,7 @@ type Config struct {
 	GroupName          string // preferred
 	AppName            string // deprecated alias for GroupName
 	StreamName         string
+	StreamARN          string // preferred over StreamName; required for cross-account streams
 	WorkerID           string
 	KinesisClient      KinesisClient
 	Repository         LeaseRepository
@@ -91,6 +94,12 @@ type Group struct {
 	releasing  map[string]bool
 	shardStop  map[string]context.CancelFunc
 	shardCache map[string]types.Shard
+	// closedWhenListed holds the shards that were closed when this worker
+	// first listed them.
+	closedWhenListed map[string]bool
+	// leases are the leases listed by the last assignment round. The map is
+	// replaced, never modified.
+	leases map[string]Lease
 }
 
 type noopCheckpointStore struct{}
@@ -111,7 +120,12 @@ func New(cfg Config) (*Group, error) {
 	if groupName == "" {
 		return nil, errors.New("group name is required")
 	}
-	if cfg.StreamName == "" {
+	// An ARN-addressed group keys its lease namespace and checkpoints by the ARN.
+	streamName := cfg.StreamName
+	if cfg.StreamARN != "" {
+		streamName = cfg.StreamARN
+	}
+	if streamName == "" {
 		return nil, errors.New("stream name is required")
 	}
 	if cfg.WorkerID == "" {
@@ -141,7 +155,7 @@ func New(cfg Config) (*Group, error) {
 
 	return &Group{
 		appName:            groupName,
-		streamName:         cfg.StreamName,
+		streamName:         streamName,
 		workerID:           cfg.WorkerID,
 		client:             cfg.KinesisClient,
 		repo:               cfg.Repository,
@@ -156,6 +170,7 @@ func New(cfg Config) (*Group, error) {
 		releasing:          map[string]bool{},
 		shardStop:          map[string]context.CancelFunc{},
 		shardCache:         map[string]types.Shard{},
+		closedWhenListed:   map[string]bool{},
 	}, nil
 }
 
@@ -252,6 +267,79 @@ func (g *Group) ShardStopped(ctx context.Context, shardID string) error {
 	return g.repo.ReleaseLease(ctx, g.namespace(), shardID, g.workerID)
 }
 
+// ParentsConsumed reports whether a parent of the shard was consumed by the
+// group, in which case the consumer starts the shard at TRIM_HORIZON when it
+// has no checkpoint. A parent counts as consumed once its lease is completed
+// and it has a checkpoint, was open when this worker first listed it, or was
+// itself the child of a consumed shard. Shards that were already closed when
+// the group started, without a checkpoint, were skipped by the initial
+// position, and so are their children. It uses the leases of the assignment
+// round that claimed the shard, which saw its parents completed.
+func (g *Group) ParentsConsumed(_ context.Context, shardID string) (bool, error) {
+	g.mu.Lock()
+	lease, ok := g.leases[shardID]
+	if !ok || lease.ParentShardID == "" && lease.AdjacentParentID == "" {
+		g.mu.Unlock()
+		return false, nil
+	}
+	lineage := shardLineage{
+		store:            g.store,
+		streamName:       g.streamName,
+		leases:           g.leases,
+		completed:        maps.Clone(g.completed),
+		closedWhenListed: maps.Clone(g.closedWhenListed),
+	}
+	g.mu.Unlock()
+
+	return lineage.parentsConsumed(shardID)
+}
+
+// shardLineage tells consumed shards apart from a snapshot of the leases and
+// the shards this worker completed since.
+type shardLineage struct {
+	store            CheckpointStore
+	streamName       string
+	leases           map[string]Lease
+	completed        map[string]bool
+	closedWhenListed map[string]bool
+}
+
+func (l shardLineage) parentsConsumed(shardID string) (bool, error) {
+	lease, ok := l.leases[shardID]
+	if !ok {
+		return false, nil
+	}
+	for _, parentID := range []string{lease.ParentShardID, lease.AdjacentParentID} {
+		if parentID == "" {
+			continue
+		}
+		consumed, err := l.consumed(parentID)
+		if err != nil || consumed {
+			return consumed, err
+		}
+	}
+	return false, nil
+}
+
+func (l shardLineage) consumed(shardID string) (bool, error) {
+	lease, ok := l.leases[shardID]
+	if !ok || !lease.Completed && !l.completed[shardID] {
+		return false, nil
+	}
+	if closed, listed := l.closedWhenListed[shardID]; listed && !closed {
+		return true, nil
+	}
+
+	checkpoint, err := l.store.GetCheckpoint(l.streamName, shardID)
+	if err != nil {
+		return false, err
+	}
+	if checkpoint != "" {
+		return true, nil
+	}
+	return l.parentsConsumed(shardID)
+}
+
 func (g *Group) runOnce(ctx context.Context, shardC chan types.Shard) error {
 	now := g.clock.Now()
 
@@ -265,7 +353,11 @@ func (g *Group) runOnce(ctx context.Context, shardC chan types.Shard) error {
 
 	g.mu.Lock()
 	for _, shard := range shards {
-		g.shardCache[aws.ToString(shard.ShardId)] = shard
+		shardID := aws.ToString(shard.ShardId)
+		if _, ok := g.shardCache[shardID]; !ok {
+			g.closedWhenListed[shardID] = shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil
+		}
+		g.shardCache[shardID] = shard
 	}
 	g.mu.Unlock()
 
@@ -281,6 +373,13 @@ func (g *Group) runOnce(ctx context.Context, shardC chan types.Shard) error {
 	if err != nil {
 		return err
 	}
+	leasesByShard := make(map[string]Lease, len(leases))
+	for _, lease := range leases {
+		leasesByShard[lease.ShardID] = lease
+	}
+	g.mu.Lock()
+	g.leases = leasesByShard
+	g.mu.Unlock()
 
 	planner := assignmentPlanner{
 		WorkerID:           g.workerID,
@@ -407,9 +506,12 @@ func (g *Group) namespace() string {
 	return fmt.Sprintf("%s#%s", g.appName, g.streamName)
 }
 
-func (g *Group) listShards(ctx context.Context, streamName string) ([]types.Shard, error) {
+func (g *Group) listShards(ctx context.Context, stream string) ([]types.Shard, error) {
 	var shards []types.Shard
-	input := &kinesis.ListShardsInput{StreamName: aws.String(streamName)}
+	input := &kinesis.ListShardsInput{StreamName: aws.String(stream)}
+	if strings.HasPrefix(stream, "arn:") {
+		input = &kinesis.ListShardsInput{StreamARN: aws.String(stream)}
+	}
 
 	for {
 		resp, err := g.client.ListShards(ctx, input)
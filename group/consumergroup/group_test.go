@@ -300,6 +300,51 @@ func TestGroupRunOnce_ClaimsAndEmitsShards(t *testing.T) {
 	}
 }
 
+type recordingKinesisClient struct {
+	fakeKinesisClient
+	inputs []*kinesis.ListShardsInput
+}
+
+func (r *recordingKinesisClient) ListShards(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+	r.inputs = append(r.inputs, params)
+	return r.fakeKinesisClient.ListShards(ctx, params, optFns...)
+}
+
+func TestGroupRunOnce_StreamARNAddressesShardsAndNamespace(t *testing.T) {
+	const streamARN = "arn:aws:kinesis:us-east-1:123456789012:stream/my-stream"
+	now := time.Unix(1700000000, 0).UTC()
+	repo := newFakeLeaseRepo(nil)
+	client := &recordingKinesisClient{
+		fakeKinesisClient: fakeKinesisClient{shards: []types.Shard{{ShardId: aws.String("s0")}}},
+	}
+
+	group, err := New(Config{
+		AppName:       "my-app",
+		StreamName:    "my-stream",
+		StreamARN:     streamARN,
+		WorkerID:      "worker-a",
+		KinesisClient: client,
+		Repository:    repo,
+		Clock:         fakeClock{now: now},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	shardC := make(chan types.Shard, 1)
+	if err := group.runOnce(context.Background(), shardC); err != nil {
+		t.Fatalf("runOnce() error = %v", err)
+	}
+
+	input := client.inputs[0]
+	if aws.ToString(input.StreamARN) != streamARN || input.StreamName != nil {
+		t.Fatalf("ListShards input = name:%q arn:%q, want arn only", aws.ToString(input.StreamName), aws.ToString(input.StreamARN))
+	}
+	if got, want := group.namespace(), "my-app#"+streamARN; got != want {
+		t.Fatalf("namespace() = %q, want %q", got, want)
+	}
+}
+
 func TestGroupRunOnce_RequestsHandoffWhenUnderTarget(t *testing.T) {
 	now := time.Unix(1700000000, 0).UTC()
 	repo := newFakeLeaseRepo([]Lease{
@@ -518,6 +563,78 @@ func TestGroupRunOnce_WaitsForParentCompletionBeforeClaimingChild(t *testing.T)
 	}
 }
 
+func TestGroupParentsConsumed_ChildOfConsumedParent(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	repo := &listCountingLeaseRepo{fakeLeaseRepo: newFakeLeaseRepo(nil)}
+	closed := &types.SequenceNumberRange{StartingSequenceNumber: aws.String("1"), EndingSequenceNumber: aws.String("9")}
+	client := &fakeKinesisClient{
+		shards: []types.Shard{
+			{ShardId: aws.String("open-parent")},
+			{ShardId: aws.String("closed-parent"), SequenceNumberRange: closed},
+			{ShardId: aws.String("checkpointed-parent"), SequenceNumberRange: closed},
+			{ShardId: aws.String("child-a"), ParentShardId: aws.String("open-parent")},
+			{ShardId: aws.String("child-b"), ParentShardId: aws.String("closed-parent")},
+			{ShardId: aws.String("child-c"), ParentShardId: aws.String("checkpointed-parent")},
+		},
+	}
+	store := newFakeCheckpointStore()
+	if err := store.SetCheckpoint("my-stream", "checkpointed-parent", "5"); err != nil {
+		t.Fatalf("SetCheckpoint() error = %v", err)
+	}
+
+	group, err := New(Config{
+		AppName:         "my-app",
+		StreamName:      "my-stream",
+		WorkerID:        "worker-a",
+		KinesisClient:   client,
+		Repository:      repo,
+		CheckpointStore: store,
+		Clock:           fakeClock{now: now},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	shardC := make(chan types.Shard, 6)
+	if err := group.runOnce(context.Background(), shardC); err != nil {
+		t.Fatalf("runOnce() error = %v", err)
+	}
+	if consumed, err := group.ParentsConsumed(context.Background(), "child-a"); err != nil || consumed {
+		t.Fatalf("ParentsConsumed(child-a) = %v, %v before the parent completed; want false", consumed, err)
+	}
+
+	for _, shardID := range []string{"open-parent", "closed-parent", "checkpointed-parent"} {
+		if err := group.CloseShard(context.Background(), shardID); err != nil {
+			t.Fatalf("CloseShard(%s) error = %v", shardID, err)
+		}
+	}
+
+	lists := repo.listCalls
+	for shardID, want := range map[string]bool{"child-a": true, "child-b": false, "child-c": true, "open-parent": false} {
+		consumed, err := group.ParentsConsumed(context.Background(), shardID)
+		if err != nil {
+			t.Fatalf("ParentsConsumed(%s) error = %v", shardID, err)
+		}
+		if consumed != want {
+			t.Fatalf("ParentsConsumed(%s) = %v, want %v", shardID, consumed, want)
+		}
+	}
+	if repo.listCalls != lists {
+		t.Fatalf("ListLeases calls = %d, want the leases of the last assignment round reused", repo.listCalls-lists)
+	}
+}
+
+// listCountingLeaseRepo counts ListLeases calls.
+type listCountingLeaseRepo struct {
+	*fakeLeaseRepo
+	listCalls int
+}
+
+func (r *listCountingLeaseRepo) ListLeases(ctx context.Context, namespace string) ([]Lease, error) {
+	r.listCalls++
+	return r.fakeLeaseRepo.ListLeases(ctx, namespace)
+}
+
 func TestGroupRunOnce_WaitsForBothMergeParents(t *testing.T) {
 	now := time.Unix(1700000000, 0).UTC()
 	repo := newFakeLeaseRepo(nil)
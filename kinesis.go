@@ -3,17 +3,21 @@ package consumer
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 )
 
-// listShards pulls a list of Shard IDs from the kinesis api
-func listShards(ctx context.Context, ksis kinesisClient, streamName string) ([]types.Shard, error) {
+// listShards pulls a list of Shard IDs from the kinesis api. The stream may be
+// given by name or ARN.
+func listShards(ctx context.Context, ksis kinesisClient, stream string) ([]types.Shard, error) {
 	var ss []types.Shard
+	streamName, streamARN := streamParams(stream)
 	var listShardsInput = &kinesis.ListShardsInput{
-		StreamName: aws.String(streamName),
+		StreamName: streamName,
+		StreamARN:  streamARN,
 	}
 
 	for {
@@ -32,3 +36,50 @@ func listShards(ctx context.Context, ksis kinesisClient, streamName string) ([]t
 		}
 	}
 }
+
+// listShardsWithRetry calls listShards, retrying failures the policy allows.
+func listShardsWithRetry(ctx context.Context, ksis kinesisClient, stream string, policy RetryPolicy, wait retryWaitFunc, logger Logger) ([]types.Shard, error) {
+	for attempt := 1; ; attempt++ {
+		shards, err := listShards(ctx, ksis, stream)
+		if err == nil || ctx.Err() != nil {
+			return shards, err
+		}
+		delay, ok := policy.Retry(OperationListShards, err, attempt)
+		if !ok {
+			return nil, err
+		}
+		logger.Log("[GROUP] list shards retry:", attempt, delay, err)
+		if !wait(ctx, delay) {
+			return nil, err
+		}
+	}
+}
+
+// isStreamARN reports whether a stream identifier is an ARN rather than a name.
+func isStreamARN(stream string) bool {
+	return strings.HasPrefix(stream, "arn:")
+}
+
+// streamParams returns the StreamName and StreamARN request parameters for a
+// stream identifier. Exactly one of them is set; cross-account streams must be
+// addressed by ARN.
+func streamParams(stream string) (streamName, streamARN *string) {
+	if isStreamARN(stream) {
+		return nil, aws.String(stream)
+	}
+	return aws.String(stream), nil
+}
+
+// validateStreamARN checks that the ARN has the form
+// arn:<partition>:kinesis:<region>:<account>:stream/<name>.
+func validateStreamARN(streamARN string) error {
+	parts := strings.SplitN(streamARN, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "kinesis" || parts[3] == "" || parts[4] == "" {
+		return fmt.Errorf("invalid stream ARN %q", streamARN)
+	}
+	name, ok := strings.CutPrefix(parts[5], "stream/")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid stream ARN %q", streamARN)
+	}
+	return nil
+}
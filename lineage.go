@@ -0,0 +1,38 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// shardLineageProvider is implemented by groups that track which shards were
+// consumed, so children of a consumed shard do not skip records.
+type shardLineageProvider interface {
+	// ParentsConsumed reports whether a parent of the shard was consumed.
+	ParentsConsumed(ctx context.Context, shardID string) (bool, error)
+}
+
+// startsAtTrimHorizon reports whether a shard without a checkpoint starts at
+// TRIM_HORIZON rather than the initial position because a parent shard was
+// consumed. The child then holds the records written since the split, which
+// the initial position, e.g. LATEST, would skip.
+func (c *Consumer) startsAtTrimHorizon(ctx context.Context, shardID string) (bool, error) {
+	if c.initialShardIteratorType == types.ShardIteratorTypeTrimHorizon && c.initialTimestamp == nil {
+		return false, nil
+	}
+	lineage, ok := c.group.(shardLineageProvider)
+	if !ok {
+		return false, nil
+	}
+
+	consumed, err := lineage.ParentsConsumed(ctx, shardID)
+	if err != nil {
+		return false, fmt.Errorf("shard lineage error: %w", err)
+	}
+	if consumed {
+		c.logger.Log("[CONSUMER] parent shard consumed, starting at TRIM_HORIZON:", shardID)
+	}
+	return consumed, nil
+}
@@ -0,0 +1,108 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+// newLineageClient lists an open parent, a parent that was closed when
+// listed, a closed parent with a checkpoint, and a child of each.
+func newLineageClient() *kinesisClientMock {
+	closed := &types.SequenceNumberRange{StartingSequenceNumber: aws.String("1"), EndingSequenceNumber: aws.String("9")}
+	return &kinesisClientMock{
+		listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+			return &kinesis.ListShardsOutput{
+				Shards: []types.Shard{
+					{ShardId: aws.String("open-parent")},
+					{ShardId: aws.String("closed-parent"), SequenceNumberRange: closed},
+					{ShardId: aws.String("checkpointed-parent"), SequenceNumberRange: closed},
+					{ShardId: aws.String("child-a"), ParentShardId: aws.String("open-parent")},
+					{ShardId: aws.String("child-b"), ParentShardId: aws.String("closed-parent")},
+					{ShardId: aws.String("child-c"), ParentShardId: aws.String("checkpointed-parent")},
+				},
+			}, nil
+		},
+	}
+}
+
+func TestAllGroup_ParentsConsumed(t *testing.T) {
+	checkpoints := store.New()
+	if err := checkpoints.SetCheckpoint("test-stream", "checkpointed-parent", "5"); err != nil {
+		t.Fatalf("SetCheckpoint(parent) failed: %v", err)
+	}
+	group := NewAllGroup(newLineageClient(), checkpoints, "test-stream", &testLogger{t})
+
+	ctx := context.Background()
+	shardC := make(chan types.Shard, 10)
+	if err := group.findNewShards(ctx, shardC); err != nil {
+		t.Fatalf("findNewShards failed: %v", err)
+	}
+
+	if consumed, err := group.ParentsConsumed(ctx, "child-a"); err != nil || consumed {
+		t.Fatalf("ParentsConsumed(child-a) = %v, %v before the parent closed; want false", consumed, err)
+	}
+
+	for _, shardID := range []string{"open-parent", "closed-parent", "checkpointed-parent"} {
+		if err := group.CloseShard(ctx, shardID); err != nil {
+			t.Fatalf("CloseShard(%s) failed: %v", shardID, err)
+		}
+	}
+
+	for shardID, want := range map[string]bool{"child-a": true, "child-b": false, "child-c": true, "open-parent": false} {
+		consumed, err := group.ParentsConsumed(ctx, shardID)
+		if err != nil {
+			t.Fatalf("ParentsConsumed(%s) failed: %v", shardID, err)
+		}
+		if consumed != want {
+			t.Errorf("ParentsConsumed(%s) = %v, want %v", shardID, consumed, want)
+		}
+	}
+}
+
+func TestGetShardIterator_ChildOfConsumedParentStartsAtTrimHorizon(t *testing.T) {
+	client := newLineageClient()
+	iteratorTypes := map[string]types.ShardIteratorType{}
+	client.getShardIteratorMock = func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+		iteratorTypes[aws.ToString(params.ShardId)] = params.ShardIteratorType
+		return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+	}
+
+	group := NewAllGroup(client, store.New(), "myStreamName", &testLogger{t})
+	c, err := New("myStreamName", WithClient(client), WithGroup(group))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := group.findNewShards(ctx, make(chan types.Shard, 10)); err != nil {
+		t.Fatalf("findNewShards failed: %v", err)
+	}
+	for _, shardID := range []string{"open-parent", "closed-parent"} {
+		if err := group.CloseShard(ctx, shardID); err != nil {
+			t.Fatalf("CloseShard(%s) failed: %v", shardID, err)
+		}
+	}
+
+	for _, shardID := range []string{"open-parent", "child-a", "child-b"} {
+		if _, err := c.getShardIterator(ctx, "myStreamName", shardID, ""); err != nil {
+			t.Fatalf("getShardIterator(%s) error: %v", shardID, err)
+		}
+	}
+
+	want := map[string]types.ShardIteratorType{
+		"open-parent": types.ShardIteratorTypeLatest,
+		"child-a":     types.ShardIteratorTypeTrimHorizon,
+		"child-b":     types.ShardIteratorTypeLatest,
+	}
+	for shardID, wantType := range want {
+		if got := iteratorTypes[shardID]; got != wantType {
+			t.Errorf("ShardIteratorType(%s) = %q, want %q", shardID, got, wantType)
+		}
+	}
+}
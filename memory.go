@@ -0,0 +1,176 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// maxGetRecordsBytes is the most data a GetRecords call returns.
+	maxGetRecordsBytes = 10 << 20
+	// maxRecordBytes is the largest record a stream accepts.
+	maxRecordBytes = 1 << 20
+)
+
+// memoryBudget bounds the bytes of fetched records held by the consumer.
+// released and pressure are closed and replaced on every release, and every
+// time an acquire has to wait, respectively.
+type memoryBudget struct {
+	capacity int64
+
+	mu       sync.Mutex
+	used     int64
+	released chan struct{}
+	pressure chan struct{}
+}
+
+func newMemoryBudget(capacity int64) *memoryBudget {
+	return &memoryBudget{
+		capacity: capacity,
+		released: make(chan struct{}),
+		pressure: make(chan struct{}),
+	}
+}
+
+// acquire waits until n bytes are available and returns a lease holding them.
+// n is capped at the capacity so a single large page can always be read. The
+// lease is nil without a budget. ok is false when ctx is done first.
+func (b *memoryBudget) acquire(ctx context.Context, n int64) (lease *memoryLease, ok bool) {
+	if b == nil {
+		return nil, true
+	}
+	n = min(n, b.capacity)
+
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.capacity {
+			b.used += n
+			b.mu.Unlock()
+			return &memoryLease{budget: b, held: n}, true
+		}
+		released := b.released
+		close(b.pressure)
+		b.pressure = make(chan struct{})
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-released:
+		}
+	}
+}
+
+func (b *memoryBudget) release(n int64) {
+	if b == nil || n <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used -= n
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// pressured returns a channel closed the next time an acquire has to wait, so
+// holders of buffered records can give memory back. It is nil without a
+// budget.
+func (b *memoryBudget) pressured() <-chan struct{} {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.pressure
+}
+
+// memoryLease is the budget held by one page of records. A nil lease holds
+// nothing.
+type memoryLease struct {
+	budget *memoryBudget
+
+	mu   sync.Mutex
+	held int64
+}
+
+// shrink gives back what the lease holds beyond n bytes, once the size of the
+// page is known.
+func (l *memoryLease) shrink(n int64) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	surplus := l.held - max(n, 0)
+	if surplus <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	l.held -= surplus
+	l.mu.Unlock()
+
+	l.budget.release(surplus)
+}
+
+// retain moves up to n bytes out of the lease for a record that outlives its
+// page, and returns how many were moved. The caller releases them from the
+// budget once done with the record.
+func (l *memoryLease) retain(n int64) int64 {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n = min(n, l.held)
+	l.held -= n
+	return n
+}
+
+func (l *memoryLease) release() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	n := l.held
+	l.held = 0
+	l.mu.Unlock()
+
+	l.budget.release(n)
+}
+
+// bind makes the records of the page passed to fn point at the lease, so
+// ScanBatch can retain their memory while they are buffered.
+func (l *memoryLease) bind(fn ScanFunc) ScanFunc {
+	if l == nil {
+		return fn
+	}
+	return func(r *Record) error {
+		r.memory = l
+		return fn(r)
+	}
+}
+
+// getRecordsReservation is what a GetRecords call reserves before the size
+// of its page is known: the most it can return.
+func (c *Consumer) getRecordsReservation() int64 {
+	if c.maxRecords > 0 && c.maxRecords < maxGetRecordsBytes/maxRecordBytes {
+		return c.maxRecords * maxRecordBytes
+	}
+	return maxGetRecordsBytes
+}
+
+// recordSize is the size of a record as counted against the memory budget.
+func recordSize(r *Record) int64 {
+	n := int64(len(r.Data))
+	if r.PartitionKey != nil {
+		n += int64(len(*r.PartitionKey))
+	}
+	return n
+}
@@ -0,0 +1,210 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func TestMemoryBudget_AcquireWaitsForRelease(t *testing.T) {
+	b := newMemoryBudget(10)
+	ctx := context.Background()
+
+	big, _ := b.acquire(ctx, 100)
+	if big.held != 10 {
+		t.Fatalf("held = %d, want acquire capped at the capacity", big.held)
+	}
+	big.shrink(8)
+
+	pressure := b.pressured()
+	acquired := make(chan *memoryLease)
+	go func() {
+		lease, _ := b.acquire(ctx, 5)
+		acquired <- lease
+	}()
+
+	<-pressure
+	select {
+	case <-acquired:
+		t.Fatal("acquire returned while the budget was exhausted")
+	default:
+	}
+
+	big.shrink(5)
+	lease := <-acquired
+	lease.release()
+	big.release()
+	if b.used != 0 {
+		t.Fatalf("used = %d after releasing every lease, want 0", b.used)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	full, _ := b.acquire(context.Background(), 10)
+	if _, ok := b.acquire(ctx, 1); ok {
+		t.Fatal("acquire succeeded with a cancelled context and no budget left")
+	}
+	full.release()
+}
+
+func TestScan_MemoryBudgetBoundsFetchedPages(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		fetched  = map[string]bool{}
+		inFlight int
+		maxPages int
+	)
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: params.ShardId}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			shardID := aws.ToString(params.ShardIterator)
+			if fetched[shardID] {
+				return &kinesis.GetRecordsOutput{}, nil
+			}
+			fetched[shardID] = true
+			inFlight++
+			maxPages = max(maxPages, inFlight)
+			// the shard closes after its only page
+			return &kinesis.GetRecordsOutput{Records: records}, nil
+		},
+		listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+			return &kinesis.ListShardsOutput{Shards: []types.Shard{
+				{ShardId: aws.String("shard-1")},
+				{ShardId: aws.String("shard-2")},
+			}}, nil
+		},
+	}
+
+	// one record per call reserves 1 MB, the whole budget
+	c, err := New("myStreamName", WithClient(client), WithMaxRecords(1), WithMemoryBudget(maxRecordBytes))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var processed int
+	err = c.Scan(ctx, func(r *Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed++
+		if aws.ToString(r.SequenceNumber) == "lastSeqNum" {
+			inFlight--
+		}
+		if processed == 2*len(records) {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	if processed != 2*len(records) {
+		t.Fatalf("processed = %d, want %d", processed, 2*len(records))
+	}
+	if maxPages != 1 {
+		t.Fatalf("pages held at once = %d, want 1", maxPages)
+	}
+	if c.memory.used != 0 {
+		t.Fatalf("budget used = %d after the scan, want 0", c.memory.used)
+	}
+}
+
+func TestScanBatch_MemoryBudgetFlushesBuffersUnderPressure(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newOpenShardClient()), WithStore(cp), WithScanInterval(time.Millisecond), WithMaxRecords(1), WithMemoryBudget(maxRecordBytes))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batches := make(chan []*Record, 1)
+	scanErr := make(chan error, 1)
+	go func() {
+		// neither the size nor the interval ever flushes the buffer
+		scanErr <- c.ScanBatch(ctx, func(batch []*Record) error {
+			batches <- batch
+			return nil
+		}, WithBatchMaxSize(100), WithBatchFlushInterval(0))
+	}()
+
+	select {
+	case batch := <-batches:
+		if len(batch) != len(records) {
+			t.Fatalf("batch size = %d, want %d", len(batch), len(records))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("buffer was not flushed while the next fetch waited for memory")
+	}
+
+	cancel()
+	if err := <-scanErr; err != nil {
+		t.Fatalf("scan batch error: %v", err)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want lastSeqNum", val)
+	}
+	if c.memory.used != 0 {
+		t.Fatalf("budget used = %d after the scan, want 0", c.memory.used)
+	}
+}
+
+func TestScanAck_MemoryBudgetHoldsRecordsUntilAcked(t *testing.T) {
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithMemoryBudget(maxGetRecordsBytes))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	delivered := make(chan *Record, len(records))
+	scanErr := make(chan error, 1)
+	go func() {
+		scanErr <- c.ScanAck(ctx, func(r *Record) error {
+			delivered <- r
+			return nil
+		})
+	}()
+
+	first, last := <-delivered, <-delivered
+	held := func() int64 {
+		c.memory.mu.Lock()
+		defer c.memory.mu.Unlock()
+		return c.memory.used
+	}
+	want := recordSize(first) + recordSize(last)
+	// the shard may already hold a reservation for its next fetch
+	if got := held(); got < want {
+		t.Fatalf("budget used = %d with two unacked records, want at least %d", got, want)
+	}
+
+	first.Ack()
+	cancel()
+	if err := <-scanErr; err != nil {
+		t.Fatalf("scan ack error: %v", err)
+	}
+	if got := held(); got != 0 {
+		t.Fatalf("budget used = %d after the scan, want 0", got)
+	}
+	// acknowledging after the scan does not release twice
+	last.Ack()
+	if got := held(); got != 0 {
+		t.Fatalf("budget used = %d after a late ack, want 0", got)
+	}
+}
@@ -0,0 +1,91 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ErrRecordTimeout is returned by TimeoutMiddleware when the callback does
+// not return in time.
+var ErrRecordTimeout = errors.New("record processing timed out")
+
+// Middleware wraps a ScanFunc, e.g. to add logging, metrics or recovery.
+type Middleware func(ScanFunc) ScanFunc
+
+// applyMiddleware wraps fn so the first middleware is the outermost.
+func (c *Consumer) applyMiddleware(fn ScanFunc) ScanFunc {
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		fn = c.middleware[i](fn)
+	}
+	return fn
+}
+
+// RecoverMiddleware turns a panic in the callback into a *PanicError, which
+// stops the scan or, with WithDeadLetter, retries and dead-letters the record.
+// Without it a panic still stops the scan with a *PanicError, but the record
+// is not retried.
+func RecoverMiddleware() Middleware {
+	return recoverScanFunc
+}
+
+// TimeoutMiddleware fails a record with ErrRecordTimeout when the callback
+// takes longer than d. The callback cannot be interrupted, so it keeps running
+// in the background while the record is retried or the scan stops. A panic
+// in the callback is raised again on the caller's goroutine so middleware
+// around it can recover it.
+func TimeoutMiddleware(d time.Duration) Middleware {
+	type result struct {
+		err      error
+		panicked bool
+		p        any
+	}
+
+	return func(next ScanFunc) ScanFunc {
+		return func(r *Record) error {
+			resC := make(chan result, 1)
+			go func() {
+				panicked := true
+				defer func() {
+					if panicked {
+						resC <- result{panicked: true, p: recover()}
+					}
+				}()
+				err := next(r)
+				panicked = false
+				resC <- result{err: err}
+			}()
+
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case res := <-resC:
+				if res.panicked {
+					panic(res.p)
+				}
+				return res.err
+			case <-timer.C:
+				return fmt.Errorf("record %s: %w", aws.ToString(r.SequenceNumber), ErrRecordTimeout)
+			}
+		}
+	}
+}
+
+// LatencyMiddleware adds the time spent in the callback to the consumer's
+// counter, set with WithCounter, in microseconds, as "record_latency_us" and
+// counts calls as "record_calls", so the mean latency is their ratio.
+func LatencyMiddleware() Middleware {
+	return func(next ScanFunc) ScanFunc {
+		return func(r *Record) error {
+			start := time.Now()
+			err := next(r)
+			if r.counter != nil {
+				r.counter.Add("record_latency_us", time.Since(start).Microseconds())
+				r.counter.Add("record_calls", 1)
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func TestScanShard_MiddlewareOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next ScanFunc) ScanFunc {
+			return func(r *Record) error {
+				calls = append(calls, name)
+				return next(r)
+			}
+		}
+	}
+
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithMiddleware(tag("outer"), tag("inner")))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	err = c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		calls = append(calls, "fn")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+	if got := strings.Join(calls, ","); got != "outer,inner,fn,outer,inner,fn" {
+		t.Fatalf("calls = %s, want each record through outer, inner, fn", got)
+	}
+}
+
+func TestScanShard_RecoverMiddleware(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithStore(cp), WithMiddleware(RecoverMiddleware()))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	err = c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		if string(r.Data) == "lastData" {
+			panic("boom")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("scan shard error = %v, want recovered panic", err)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "firstSeqNum" {
+		t.Fatalf("checkpoint = %q, want firstSeqNum", val)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	fn := TimeoutMiddleware(10 * time.Millisecond)(func(r *Record) error {
+		switch string(r.Data) {
+		case "slow":
+			<-release
+		case "panic":
+			panic("boom")
+		}
+		return nil
+	})
+
+	if err := fn(&Record{}); err != nil {
+		t.Fatalf("fast record error = %v, want nil", err)
+	}
+	slow := &Record{}
+	slow.Data = []byte("slow")
+	if err := fn(slow); !errors.Is(err, ErrRecordTimeout) {
+		t.Fatalf("slow record error = %v, want ErrRecordTimeout", err)
+	}
+
+	panicking := &Record{}
+	panicking.Data = []byte("panic")
+	if err := RecoverMiddleware()(fn)(panicking); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("panicking record error = %v, want panic recovered by outer middleware", err)
+	}
+}
+
+func TestScanBatch_MiddlewareWrapsBatchCallback(t *testing.T) {
+	ctr := &namedCounter{}
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithCounter(ctr), WithMiddleware(LatencyMiddleware()))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var once sync.Once
+	err = c.ScanBatch(ctx, func(batch []*Record) error {
+		once.Do(cancel)
+		return nil
+	}, WithBatchMaxSize(len(records)), WithBatchFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("scan batch error: %v", err)
+	}
+	if got := ctr.Get("record_calls"); got != 1 {
+		t.Fatalf("record calls = %d, want one per batch", got)
+	}
+}
+
+func TestScanBatch_TimeoutMiddlewareBoundsBatchCallback(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithStore(cp), WithMiddleware(TimeoutMiddleware(10*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	err = c.ScanBatch(context.Background(), func(batch []*Record) error {
+		<-release
+		return nil
+	}, WithBatchMaxSize(len(records)), WithBatchFlushInterval(time.Hour))
+	if !errors.Is(err, ErrRecordTimeout) {
+		t.Fatalf("scan batch error = %v, want ErrRecordTimeout", err)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "" {
+		t.Fatalf("checkpoint = %q, want none", val)
+	}
+}
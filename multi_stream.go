@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MultiStreamConsumer scans several streams with a single callback. Each stream
+// runs its own shard discovery, and Record.StreamName identifies the stream a
+// record came from. Checkpoints are keyed by stream through the shared Store.
+type MultiStreamConsumer struct {
+	consumers []*Consumer
+}
+
+// NewMultiStream creates a consumer for the given stream names or ARNs. The
+// options are applied to every stream, so the client, store, counter, and
+// logger are shared. Options that only make sense for a single stream
+// (WithGroup, WithStreamARN, WithEnhancedFanOut) are rejected.
+func NewMultiStream(streams []string, opts ...Option) (*MultiStreamConsumer, error) {
+	if len(streams) == 0 {
+		return nil, errors.New("must provide at least one stream")
+	}
+
+	probe := &Consumer{}
+	for _, opt := range opts {
+		opt(probe)
+	}
+	switch {
+	case probe.group != nil:
+		return nil, errors.New("WithGroup is not supported with multiple streams")
+	case probe.streamName != "":
+		return nil, errors.New("WithStreamARN is not supported with multiple streams, pass the ARN as a stream")
+	case probe.consumerARN != "":
+		return nil, errors.New("WithEnhancedFanOut is not supported with multiple streams, use WithStreamConsumer")
+	}
+
+	m := &MultiStreamConsumer{}
+	seen := make(map[string]struct{}, len(streams))
+	for _, stream := range streams {
+		if _, ok := seen[stream]; ok {
+			return nil, fmt.Errorf("duplicate stream %q", stream)
+		}
+		seen[stream] = struct{}{}
+
+		streamOpts := opts
+		if len(m.consumers) > 0 {
+			// reuse the first consumer's client so a default client is only loaded once
+			streamOpts = append(opts[:len(opts):len(opts)], WithClient(m.consumers[0].client))
+		}
+		c, err := New(stream, streamOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("stream %s: %w", stream, err)
+		}
+		m.consumers = append(m.consumers, c)
+	}
+
+	return m, nil
+}
+
+// Scan scans every stream concurrently and calls fn for each record. An error
+// from any stream stops all of them, as with Consumer.Scan.
+func (m *MultiStreamConsumer) Scan(ctx context.Context, fn ScanFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, c := range m.consumers {
+		wg.Add(1)
+		go func(c *Consumer) {
+			defer wg.Done()
+			if err := c.Scan(ctx, fn); err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("stream %s error: %w", c.streamName, err)
+					cancel()
+				})
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return firstErr
+}
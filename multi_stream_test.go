@@ -0,0 +1,119 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func newMultiStreamClientMock() *kinesisClientMock {
+	return &kinesisClientMock{
+		listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+			return &kinesis.ListShardsOutput{
+				Shards: []types.Shard{{ShardId: aws.String("shard-0")}},
+			}, nil
+		},
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			stream := aws.ToString(params.StreamName)
+			if params.StreamARN != nil {
+				stream = aws.ToString(params.StreamARN)
+			}
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String(stream)}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			stream := aws.ToString(params.ShardIterator)
+			return &kinesis.GetRecordsOutput{
+				Records: []types.Record{{
+					Data:           []byte(stream),
+					SequenceNumber: aws.String(stream + "-seq"),
+				}},
+			}, nil
+		},
+	}
+}
+
+func TestMultiStreamScan_RecordsCarryStreamAndCheckpointPerStream(t *testing.T) {
+	const streamARN = "arn:aws:kinesis:us-east-1:123456789012:stream/other"
+	cp := store.New()
+
+	m, err := NewMultiStream([]string{"orders", streamARN},
+		WithClient(newMultiStreamClientMock()),
+		WithStore(cp),
+	)
+	if err != nil {
+		t.Fatalf("new multi-stream consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		seen = map[string]string{}
+	)
+	err = m.Scan(ctx, func(r *Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[r.StreamName] = string(r.Data)
+		if len(seen) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	for _, stream := range []string{"orders", streamARN} {
+		if seen[stream] != stream {
+			t.Errorf("record for stream %q has data %q", stream, seen[stream])
+		}
+		if val, _ := cp.GetCheckpoint(stream, "shard-0"); val != stream+"-seq" {
+			t.Errorf("checkpoint for %q = %q, want %q", stream, val, stream+"-seq")
+		}
+	}
+}
+
+func TestMultiStreamScan_ErrorStopsAllStreams(t *testing.T) {
+	m, err := NewMultiStream([]string{"orders", "payments"}, WithClient(newMultiStreamClientMock()))
+	if err != nil {
+		t.Fatalf("new multi-stream consumer error: %v", err)
+	}
+
+	scanErr := errors.New("bad payments record")
+	err = m.Scan(context.Background(), func(r *Record) error {
+		if r.StreamName == "payments" {
+			return scanErr
+		}
+		return nil
+	})
+	if !errors.Is(err, scanErr) {
+		t.Fatalf("scan error = %v, want %v", err, scanErr)
+	}
+}
+
+func TestNewMultiStream_Validation(t *testing.T) {
+	client := WithClient(newMultiStreamClientMock())
+	tests := map[string]struct {
+		streams []string
+		opts    []Option
+	}{
+		"no streams":      {streams: nil, opts: []Option{client}},
+		"duplicate":       {streams: []string{"orders", "orders"}, opts: []Option{client}},
+		"group":           {streams: []string{"orders"}, opts: []Option{client, WithGroup(&groupMock{})}},
+		"stream arn":      {streams: []string{"orders"}, opts: []Option{client, WithStreamARN("arn:aws:kinesis:us-east-1:123456789012:stream/orders")}},
+		"enhanced fanout": {streams: []string{"orders"}, opts: []Option{client, WithEnhancedFanOut("consumer-arn")}},
+	}
+	for name, tt := range tests {
+		if _, err := NewMultiStream(tt.streams, tt.opts...); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
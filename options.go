@@ -45,6 +45,14 @@ func WithClient(client kinesisClient) Option {
 	}
 }
 
+// WithStreamARN addresses the stream by ARN instead of the name passed to New,
+// which is required for cross-account streams. Checkpoints are keyed by the ARN.
+func WithStreamARN(streamARN string) Option {
+	return func(c *Consumer) {
+		c.streamName = streamARN
+	}
+}
+
 // WithShardIteratorType overrides the starting point for the consumer
 func WithShardIteratorType(t string) Option {
 	return func(c *Consumer) {
@@ -66,6 +74,60 @@ func WithScanInterval(d time.Duration) Option {
 	}
 }
 
+// WithAdaptivePolling replaces the fixed scan interval with polling driven by
+// each GetRecords response. A shard is polled again immediately while the
+// response was full or MillisBehindLatest is at or above the lag threshold,
+// and the interval doubles up to maxInterval while responses are empty. Calls
+// are never made more than 5 times per second per shard.
+func WithAdaptivePolling(maxInterval time.Duration, opts ...AdaptivePollingOption) Option {
+	return func(c *Consumer) {
+		cfg := &adaptivePollingConfig{
+			maxInterval:  maxInterval,
+			lagThreshold: defaultPollLagThreshold,
+		}
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		c.adaptivePolling = cfg
+	}
+}
+
+// WithReadLimiter schedules GetRecords calls through the given limiter so they
+// stay within the per-shard read limits. Pass the same limiter to every
+// Consumer reading the stream in this process. Not used with enhanced fan-out.
+func WithReadLimiter(l *ReadLimiter) Option {
+	return func(c *Consumer) {
+		c.readLimiter = l
+	}
+}
+
+// WithPrefetch fetches up to n GetRecords responses of each shard ahead of the
+// callback, so network latency overlaps with record processing. Iterator
+// refreshes and retries happen in the fetcher. Values below 1 keep fetching
+// and processing in turn.
+func WithPrefetch(n int) Option {
+	return func(c *Consumer) {
+		c.prefetch = n
+	}
+}
+
+// WithMemoryBudget bounds the bytes of fetched records the consumer holds
+// across all shards. Before each GetRecords call a shard reserves the most the
+// call can return, 10 MB or 1 MB per record with a lower WithMaxRecords, and
+// keeps the size of the page until its records are processed or, with
+// ScanBatch, flushed and, with ScanAck, acknowledged. Shards wait for budget
+// before fetching, and ScanBatch flushes its buffers early when they do. Pass the same Option to several
+// consumers to share one budget. A budget of zero or less disables it.
+func WithMemoryBudget(bytes int64) Option {
+	var budget *memoryBudget
+	if bytes > 0 {
+		budget = newMemoryBudget(bytes)
+	}
+	return func(c *Consumer) {
+		c.memory = budget
+	}
+}
+
 // WithMaxRecords overrides the maximum number of records to be
 // returned in a single GetRecords call for the consumer (specify a
 // value of up to 10,000)
@@ -84,14 +146,117 @@ func WithGetRecordsOptions(opts ...func(*kinesis.Options)) Option {
 }
 
 // WithAggregation enables KPL record deaggregation before records are passed to
-// the scan callback. Checkpoints remain sequence-number based, so persisted
-// checkpoints cannot resume within an aggregated Kinesis record.
+// the scan callback. Checkpoints within an aggregated Kinesis record store the
+// sub-sequence number too, so a restart skips the user records already
+// processed.
 func WithAggregation(a bool) Option {
 	return func(c *Consumer) {
 		c.isAggregated = a
 	}
 }
 
+// WithEnhancedFanOut reads shards over SubscribeToShard event streams using the
+// given registered stream consumer ARN instead of polling GetRecords. Each
+// subscription is renewed every 5 minutes from the last continuation sequence
+// number; records and checkpoints follow the same path as polling mode.
+func WithEnhancedFanOut(consumerARN string) Option {
+	return func(c *Consumer) {
+		c.consumerARN = consumerARN
+	}
+}
+
+// WithStreamConsumer registers the named enhanced fan-out stream consumer, or
+// discovers it if it already exists, and waits for it to become ACTIVE before
+// New returns. The resulting consumer ARN is used as with WithEnhancedFanOut.
+func WithStreamConsumer(name string, opts ...StreamConsumerOption) Option {
+	return func(c *Consumer) {
+		cfg := &streamConsumerConfig{
+			name:          name,
+			activeTimeout: 2 * time.Minute,
+			pollInterval:  time.Second,
+		}
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		c.streamConsumer = cfg
+	}
+}
+
+// WithPayloadCodec decodes the data of each record with the first codec that
+// detects it, after KPL deaggregation and before the callback. With no codecs
+// the built-in gzip, zstd and snappy codecs are tried; ZlibCodec must be
+// given explicitly. Data no codec detects is delivered as it is; data that
+// fails to decode is a malformed record.
+func WithPayloadCodec(codecs ...PayloadCodec) Option {
+	return func(c *Consumer) {
+		if len(codecs) == 0 {
+			codecs = defaultPayloadCodecs
+		}
+		c.payloadCodecs = codecs
+	}
+}
+
+// WithMalformedRecordHandler decides what happens to a record that cannot be
+// deaggregated or whose payload cannot be decoded. By default the error stops
+// the scan. Records that do not pass the KPL magic number or checksum check are
+// not aggregates and are delivered as they are.
+func WithMalformedRecordHandler(h MalformedRecordHandler) Option {
+	return func(c *Consumer) {
+		c.malformedRecordHandler = h
+	}
+}
+
+// WithMiddleware wraps the callback of Scan and ScanShard with the given
+// middleware. The first middleware is the outermost. With ScanBatch it wraps
+// each call of the batch callback and is given the first record of the batch.
+// With WithDeadLetter each attempt goes through the middleware.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Consumer) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// WithPartitionKeyConcurrency processes up to n records of a shard at once.
+// Records are routed to workers by partition key, so records sharing a key are
+// still handled in order. The checkpoint advances only to the highest sequence
+// number below which every record has completed. Values below 2 keep the
+// default serial processing. Not supported with ScanBatch.
+func WithPartitionKeyConcurrency(n int) Option {
+	return func(c *Consumer) {
+		c.partitionKeyConcurrency = n
+	}
+}
+
+// WithDeadLetter retries records whose callback returns an error and, once the
+// attempts are exhausted, hands them to sink and continues scanning instead of
+// stopping. Dead-lettered records are checkpointed like processed ones and
+// counted as "dead_letters" on the Counter.
+func WithDeadLetter(sink DeadLetterSink, opts ...DeadLetterOption) Option {
+	return func(c *Consumer) {
+		cfg := &deadLetterConfig{
+			sink:        sink,
+			maxAttempts: deadLetterDefaultMaxAttempts,
+			retryDelay:  deadLetterDefaultRetryDelay,
+		}
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		if cfg.maxAttempts <= 0 {
+			cfg.maxAttempts = deadLetterDefaultMaxAttempts
+		}
+		c.deadLetter = cfg
+	}
+}
+
+// WithRetryPolicy overrides which failed GetRecords, GetShardIterator and
+// ListShards calls are retried and how long to wait between attempts. ListShards
+// is only retried by the default AllGroup. See NewBackoffRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Consumer) {
+		c.retryPolicy = policy
+	}
+}
+
 // ShardClosedHandler is a handler that will be called when the consumer has reached the end of a closed shard.
 // No more records for that shard will be provided by the consumer.
 // An error can be returned to stop the consumer.
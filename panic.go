@@ -0,0 +1,57 @@
+package consumer
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// PanicError is returned by a scan when the callback, or the consumer while
+// reading a shard, panics. The scan stops as for any other error: checkpoints
+// are flushed and the shard's group lease is released.
+type PanicError struct {
+	ShardID string
+	// SequenceNumber is the record being processed, or empty when the panic
+	// happened outside the callback.
+	SequenceNumber string
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func newPanicError(shardID, sequenceNumber string, value any) *PanicError {
+	return &PanicError{
+		ShardID:        shardID,
+		SequenceNumber: sequenceNumber,
+		Value:          value,
+		Stack:          debug.Stack(),
+	}
+}
+
+func (e *PanicError) Error() string {
+	if e.SequenceNumber == "" {
+		return fmt.Sprintf("panic in shard %s: %v", e.ShardID, e.Value)
+	}
+	return fmt.Sprintf("panic in shard %s at sequence number %s: %v", e.ShardID, e.SequenceNumber, e.Value)
+}
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// recoverScanFunc returns a *PanicError from fn instead of letting a panic
+// escape the shard goroutine, which would crash the process.
+func recoverScanFunc(fn ScanFunc) ScanFunc {
+	return func(r *Record) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = newPanicError(r.ShardID, aws.ToString(r.SequenceNumber), p)
+			}
+		}()
+		return fn(r)
+	}
+}
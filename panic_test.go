@@ -0,0 +1,70 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func TestScan_PanicStopsScanWithPanicError(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithStore(cp))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	err = c.Scan(context.Background(), func(r *Record) error {
+		if string(r.Data) == "lastData" {
+			panic("boom")
+		}
+		return nil
+	})
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("scan error = %v, want *PanicError", err)
+	}
+	if panicErr.ShardID != "myShard" || panicErr.SequenceNumber != "lastSeqNum" || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Fatalf("panic error = %+v", panicErr)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "firstSeqNum" {
+		t.Fatalf("checkpoint = %q, want firstSeqNum", val)
+	}
+}
+
+func TestScan_PanicReleasesShard(t *testing.T) {
+	group := &multiShardRebalanceAwareGroupMock{shards: []string{"myShard"}}
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithGroup(group))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	errBoom := errors.New("boom")
+	err = c.Scan(context.Background(), func(r *Record) error {
+		panic(errBoom)
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("scan error = %v, want panic value unwrapped", err)
+	}
+	if group.shardStoppedCalls != 1 || group.closeShardCalls != 0 {
+		t.Fatalf("ShardStopped calls = %d, CloseShard calls = %d; want the shard released once", group.shardStoppedCalls, group.closeShardCalls)
+	}
+}
+
+func TestScanBatch_PanicInBatchCallback(t *testing.T) {
+	c, err := New("myStreamName", WithClient(newSingleShardClient()))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	err = c.ScanBatch(context.Background(), func(batch []*Record) error {
+		panic("boom")
+	}, WithBatchMaxSize(1))
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.SequenceNumber != "firstSeqNum" {
+		t.Fatalf("scan batch error = %v, want *PanicError at firstSeqNum", err)
+	}
+}
@@ -0,0 +1,119 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// errRecordNotProcessed marks records a worker skipped because the page was
+// already failing or the scan was cancelled.
+var errRecordNotProcessed = errors.New("record not processed")
+
+type partitionKeyResult struct {
+	index int
+	err   error
+}
+
+// processRecordsByPartitionKey calls fn for a page of records on a bounded pool
+// of workers. Records are routed to a worker by partition key, so records with
+// the same key run in order while different keys run in parallel. The
+// checkpoint only advances to the low watermark: the highest sequence number
+// below which every record has completed.
+func (c *Consumer) processRecordsByPartitionKey(ctx context.Context, shardID string, page []types.Record, millisBehindLatest *int64, fn ScanFunc, lastSeqNum string) (string, error) {
+	records := c.shardRecords(page, lastSeqNum)
+	if len(records) == 0 {
+		return lastSeqNum, nil
+	}
+
+	workers := c.partitionKeyConcurrency
+	if workers > len(records) {
+		workers = len(records)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		stopped atomic.Bool
+		queues  = make([]chan int, workers)
+		results = make(chan partitionKeyResult, len(records))
+	)
+	for i := range queues {
+		queues[i] = make(chan int, len(records))
+		wg.Add(1)
+		go func(queue <-chan int) {
+			defer wg.Done()
+			for idx := range queue {
+				if stopped.Load() || ctx.Err() != nil {
+					results <- partitionKeyResult{index: idx, err: errRecordNotProcessed}
+					continue
+				}
+				err := fn(c.newRecord(shardID, records[idx], millisBehindLatest))
+				if err != nil && !errors.Is(err, ErrSkipCheckpoint) {
+					stopped.Store(true)
+				}
+				results <- partitionKeyResult{index: idx, err: err}
+			}
+		}(queues[i])
+	}
+
+	for idx, record := range records {
+		queues[partitionKeyWorker(aws.ToString(record.PartitionKey), workers)] <- idx
+	}
+	for _, queue := range queues {
+		close(queue)
+	}
+	defer wg.Wait()
+
+	var (
+		firstErr  error
+		completed = make([]bool, len(records))
+		skipped   = make([]bool, len(records))
+		watermark = 0
+	)
+	for range records {
+		res := <-results
+		switch {
+		case errors.Is(res.err, errRecordNotProcessed):
+			continue
+		case res.err != nil && !errors.Is(res.err, ErrSkipCheckpoint):
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+
+		completed[res.index] = true
+		skipped[res.index] = errors.Is(res.err, ErrSkipCheckpoint)
+		c.counter.Add("records", 1)
+
+		checkpointSeqNum := ""
+		for watermark < len(records) && completed[watermark] {
+			if !skipped[watermark] {
+				checkpointSeqNum = records[watermark].checkpoint
+			}
+			watermark++
+		}
+		if checkpointSeqNum == "" || firstErr != nil {
+			continue
+		}
+		if err := c.setCheckpointWithRetry(ctx, shardID, checkpointSeqNum); err != nil {
+			stopped.Store(true)
+			firstErr = err
+			continue
+		}
+		lastSeqNum = checkpointSeqNum
+	}
+
+	return lastSeqNum, firstErr
+}
+
+func partitionKeyWorker(partitionKey string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(partitionKey))
+	return int(h.Sum32() % uint32(workers))
+}
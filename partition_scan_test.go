@@ -0,0 +1,166 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// keys "a" and "b" hash to different workers when two workers are used
+var partitionedRecords = []types.Record{
+	{Data: []byte("a1"), PartitionKey: aws.String("a"), SequenceNumber: aws.String("seq1")},
+	{Data: []byte("b1"), PartitionKey: aws.String("b"), SequenceNumber: aws.String("seq2")},
+	{Data: []byte("a2"), PartitionKey: aws.String("a"), SequenceNumber: aws.String("seq3")},
+	{Data: []byte("b2"), PartitionKey: aws.String("b"), SequenceNumber: aws.String("seq4")},
+}
+
+func newPartitionedConsumer(t *testing.T, checkpoints *[]string, opts ...Option) *Consumer {
+	t.Helper()
+
+	var mu sync.Mutex
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			return &kinesis.GetRecordsOutput{Records: partitionedRecords}, nil
+		},
+	}
+	cp := &flushableStoreMock{
+		setCheckpointMock: func(streamName, shardID, sequenceNumber string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			*checkpoints = append(*checkpoints, sequenceNumber)
+			return nil
+		},
+	}
+
+	opts = append([]Option{WithClient(client), WithStore(cp), WithPartitionKeyConcurrency(2)}, opts...)
+	c, err := New("myStreamName", opts...)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	return c
+}
+
+func TestScanShard_PartitionKeyConcurrencyRunsKeysInParallel(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		seen        []string
+		checkpoints []string
+		b2Done      = make(chan struct{})
+		processed   int
+	)
+	cp := &flushableStoreMock{
+		setCheckpointMock: func(streamName, shardID, sequenceNumber string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			// b1 and b2 complete first, but the checkpoint cannot move until a1 has
+			if indexOf(seen, "a1") < 0 {
+				t.Errorf("checkpoint %q set before a1 completed", sequenceNumber)
+			}
+			checkpoints = append(checkpoints, sequenceNumber)
+			return nil
+		},
+	}
+	c := newPartitionedConsumer(t, new([]string), WithStore(cp))
+
+	err := c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		// the first "a" record only completes once the "b" records have run,
+		// which requires them to be processed concurrently
+		if string(r.Data) == "a1" {
+			<-b2Done
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, string(r.Data))
+		if string(r.Data) == "b2" {
+			close(b2Done)
+		}
+		processed++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	if processed != 4 {
+		t.Fatalf("processed = %d, want 4", processed)
+	}
+	if indexOf(seen, "a1") > indexOf(seen, "a2") || indexOf(seen, "b1") > indexOf(seen, "b2") {
+		t.Fatalf("records with the same key processed out of order: %v", seen)
+	}
+	if len(checkpoints) == 0 {
+		t.Fatal("expected checkpoints")
+	}
+	if last := checkpoints[len(checkpoints)-1]; last != "seq4" {
+		t.Fatalf("final checkpoint = %q, want %q", last, "seq4")
+	}
+}
+
+func TestScanShard_PartitionKeyConcurrencyErrorHoldsLowWatermark(t *testing.T) {
+	var checkpoints []string
+	c := newPartitionedConsumer(t, &checkpoints)
+
+	callbackErr := errors.New("callback failed")
+	err := c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		if string(r.Data) == "a1" {
+			return callbackErr
+		}
+		return nil
+	})
+	if !errors.Is(err, callbackErr) {
+		t.Fatalf("scan shard error = %v, want %v", err, callbackErr)
+	}
+	if len(checkpoints) != 0 {
+		t.Fatalf("checkpoints = %v, want none before the failed record", checkpoints)
+	}
+}
+
+func TestScanShard_PartitionKeyConcurrencySkipCheckpoint(t *testing.T) {
+	var checkpoints []string
+	c := newPartitionedConsumer(t, &checkpoints)
+
+	err := c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		if string(r.Data) == "b2" {
+			return ErrSkipCheckpoint
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+	for _, seq := range checkpoints {
+		if seq == "seq4" {
+			t.Fatalf("checkpoints = %v, skipped record was checkpointed", checkpoints)
+		}
+	}
+	if last := checkpoints[len(checkpoints)-1]; last != "seq3" {
+		t.Fatalf("final checkpoint = %q, want %q", last, "seq3")
+	}
+}
+
+func TestScanBatch_RejectsPartitionKeyConcurrency(t *testing.T) {
+	var checkpoints []string
+	c := newPartitionedConsumer(t, &checkpoints)
+
+	err := c.ScanBatch(context.Background(), func(batch []*Record) error { return nil })
+	if err == nil {
+		t.Fatal("expected error for ScanBatch with partition key concurrency")
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
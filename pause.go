@@ -0,0 +1,119 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pausedIteratorRefreshInterval renews the iterator of a paused shard before
+// the 5 minute shard iterator expiry. It is a variable for tests.
+var pausedIteratorRefreshInterval = 4 * time.Minute
+
+// Pause stops fetching records from the given shards until they are resumed.
+// Records already fetched are still processed. A paused shard stays assigned
+// to the consumer, so its consumer-group lease keeps being renewed, and its
+// shard iterator is refreshed so it does not expire.
+func (c *Consumer) Pause(shardIDs ...string) {
+	c.pauses.update(func(p *pauseState) {
+		for _, shardID := range shardIDs {
+			p.shards[shardID] = true
+		}
+	})
+}
+
+// Resume undoes Pause for the given shards. Shards stay paused while the
+// consumer is paused with PauseAll.
+func (c *Consumer) Resume(shardIDs ...string) {
+	c.pauses.update(func(p *pauseState) {
+		for _, shardID := range shardIDs {
+			delete(p.shards, shardID)
+		}
+	})
+}
+
+// PauseAll pauses every shard, including shards assigned later, as Pause
+// does for a single shard.
+func (c *Consumer) PauseAll() {
+	c.pauses.update(func(p *pauseState) {
+		p.all = true
+	})
+}
+
+// ResumeAll undoes PauseAll. Shards paused with Pause stay paused.
+func (c *Consumer) ResumeAll() {
+	c.pauses.update(func(p *pauseState) {
+		p.all = false
+	})
+}
+
+// Paused reports whether records of the shard are not being fetched.
+func (c *Consumer) Paused(shardID string) bool {
+	paused, _ := c.pauses.state(shardID)
+	return paused
+}
+
+// pauseState holds the paused shards. changed is closed and replaced on every
+// update so waiting runners re-check their shard.
+type pauseState struct {
+	mu      sync.Mutex
+	all     bool
+	shards  map[string]bool
+	changed chan struct{}
+}
+
+func (p *pauseState) update(fn func(*pauseState)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.shards == nil {
+		p.shards = make(map[string]bool)
+	}
+	fn(p)
+	if p.changed != nil {
+		close(p.changed)
+	}
+	p.changed = make(chan struct{})
+}
+
+// state reports whether the shard is paused and returns a channel closed on
+// the next update.
+func (p *pauseState) state(shardID string) (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.changed == nil {
+		p.changed = make(chan struct{})
+	}
+	return p.all || p.shards[shardID], p.changed
+}
+
+// waitWhilePaused blocks while the shard is paused. refresh is called every
+// pausedIteratorRefreshInterval meanwhile. It returns false when ctx is done.
+func (c *Consumer) waitWhilePaused(ctx context.Context, shardID string, refresh func() error) (bool, error) {
+	paused, changed := c.pauses.state(shardID)
+	if !paused {
+		return true, nil
+	}
+
+	c.logger.Log("[CONSUMER] shard paused:", shardID)
+	ticker := time.NewTicker(pausedIteratorRefreshInterval)
+	defer ticker.Stop()
+
+	for paused {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+			if refresh != nil {
+				if err := refresh(); err != nil {
+					return false, err
+				}
+			}
+		case <-changed:
+			paused, changed = c.pauses.state(shardID)
+		}
+	}
+	c.logger.Log("[CONSUMER] shard resumed:", shardID)
+	return true, nil
+}
@@ -0,0 +1,159 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func TestPause_SingleShardAndGlobal(t *testing.T) {
+	c := &Consumer{}
+
+	c.Pause("a", "b")
+	c.Resume("b")
+	if !c.Paused("a") || c.Paused("b") {
+		t.Fatalf("paused a = %v, b = %v; want only a", c.Paused("a"), c.Paused("b"))
+	}
+
+	c.PauseAll()
+	c.Resume("a")
+	if !c.Paused("a") || !c.Paused("c") {
+		t.Fatal("want every shard paused while paused globally")
+	}
+
+	c.Pause("a")
+	c.ResumeAll()
+	if !c.Paused("a") || c.Paused("c") {
+		t.Fatalf("paused a = %v, c = %v; want a still paused on its own", c.Paused("a"), c.Paused("c"))
+	}
+}
+
+func TestScanShard_PausedShardRefreshesIteratorWithoutFetching(t *testing.T) {
+	defer func(d time.Duration) { pausedIteratorRefreshInterval = d }(pausedIteratorRefreshInterval)
+	pausedIteratorRefreshInterval = time.Millisecond
+
+	var (
+		mu                sync.Mutex
+		iteratorCalls     int
+		getRecordsCalls   int
+		refreshedIterator = make(chan struct{})
+	)
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			iteratorCalls++
+			if iteratorCalls == 3 {
+				close(refreshedIterator)
+			}
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			getRecordsCalls++
+			return &kinesis.GetRecordsOutput{Records: records}, nil
+		},
+	}
+
+	c, err := New("myStreamName", WithClient(client))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	c.Pause("myShard")
+
+	var processed int
+	scanErr := make(chan error, 1)
+	go func() {
+		scanErr <- c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+			processed++
+			return nil
+		})
+	}()
+
+	<-refreshedIterator
+	mu.Lock()
+	calls := getRecordsCalls
+	mu.Unlock()
+	if calls != 0 {
+		t.Fatalf("get records calls while paused = %d, want 0", calls)
+	}
+
+	c.Resume("myShard")
+	if err := <-scanErr; err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+	if processed != len(records) {
+		t.Fatalf("processed = %d, want %d after resume", processed, len(records))
+	}
+}
+
+func TestScanShard_PausedShardRefreshesIteratorAfterLastFetchedRecord(t *testing.T) {
+	defer func(d time.Duration) { pausedIteratorRefreshInterval = d }(pausedIteratorRefreshInterval)
+	pausedIteratorRefreshInterval = time.Millisecond
+
+	var (
+		mu        sync.Mutex
+		refreshes []*kinesis.GetShardIteratorInput
+		refreshed = make(chan struct{})
+	)
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if params.ShardIteratorType != types.ShardIteratorTypeLatest {
+				refreshes = append(refreshes, params)
+				if len(refreshes) == 1 {
+					close(refreshed)
+				}
+			}
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			return &kinesis.GetRecordsOutput{NextShardIterator: aws.String("next"), Records: records}, nil
+		},
+	}
+
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(client), WithStore(cp), WithScanInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scanErr := make(chan error, 1)
+	go func() {
+		// records are not checkpointed, as with ScanAck or ScanProcessor
+		scanErr <- c.ScanShard(ctx, "myShard", func(r *Record) error {
+			if aws.ToString(r.SequenceNumber) == "lastSeqNum" {
+				c.Pause("myShard")
+			}
+			return ErrSkipCheckpoint
+		})
+	}()
+
+	<-refreshed
+	cancel()
+	if err := <-scanErr; err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	params := refreshes[0]
+	if params.ShardIteratorType != types.ShardIteratorTypeAfterSequenceNumber || aws.ToString(params.StartingSequenceNumber) != "lastSeqNum" {
+		t.Fatalf("refresh = %s %q, want AFTER_SEQUENCE_NUMBER lastSeqNum", params.ShardIteratorType, aws.ToString(params.StartingSequenceNumber))
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "" {
+		t.Fatalf("checkpoint = %q, want none", val)
+	}
+}
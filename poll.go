@@ -0,0 +1,108 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+)
+
+// minPollInterval keeps a shard within the Kinesis limit of 5 GetRecords calls
+// per second.
+const minPollInterval = 200 * time.Millisecond
+
+const defaultPollLagThreshold = time.Second
+
+// AdaptivePollingOption customizes adaptive polling.
+type AdaptivePollingOption func(*adaptivePollingConfig)
+
+type adaptivePollingConfig struct {
+	maxInterval  time.Duration
+	lagThreshold time.Duration
+}
+
+// WithPollLagThreshold sets how far behind the tip of the shard a response must
+// be for the next poll to happen without backing off. The default is 1s.
+func WithPollLagThreshold(d time.Duration) AdaptivePollingOption {
+	return func(cfg *adaptivePollingConfig) {
+		cfg.lagThreshold = d
+	}
+}
+
+// pollPacer decides when the next GetRecords call of a shard is made. resp is
+// nil when the previous call failed.
+type pollPacer interface {
+	wait(ctx context.Context, resp *kinesis.GetRecordsOutput) bool
+	stop()
+}
+
+func (c *Consumer) newPollPacer() pollPacer {
+	if c.adaptivePolling != nil {
+		return &adaptivePollPacer{
+			cfg:        c.adaptivePolling,
+			maxRecords: c.maxRecords,
+			lastPoll:   time.Now(),
+		}
+	}
+	return &fixedPollPacer{ticker: time.NewTicker(c.scanInterval)}
+}
+
+// fixedPollPacer polls every scan interval regardless of the response.
+type fixedPollPacer struct {
+	ticker *time.Ticker
+}
+
+func (p *fixedPollPacer) wait(ctx context.Context, _ *kinesis.GetRecordsOutput) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-p.ticker.C:
+		return true
+	}
+}
+
+func (p *fixedPollPacer) stop() {
+	p.ticker.Stop()
+}
+
+// adaptivePollPacer polls again as soon as the shard limit allows while the
+// consumer is behind, and doubles the interval up to the configured ceiling
+// while responses come back empty.
+type adaptivePollPacer struct {
+	cfg        *adaptivePollingConfig
+	maxRecords int64
+	backoff    time.Duration
+	lastPoll   time.Time
+}
+
+func (p *adaptivePollPacer) wait(ctx context.Context, resp *kinesis.GetRecordsOutput) bool {
+	ok := waitWithContext(ctx, p.delay(resp, time.Since(p.lastPoll)))
+	p.lastPoll = time.Now()
+	return ok
+}
+
+func (p *adaptivePollPacer) stop() {}
+
+// delay returns how long to wait before the next call given the previous
+// response and the time elapsed since the previous call started.
+func (p *adaptivePollPacer) delay(resp *kinesis.GetRecordsOutput, elapsed time.Duration) time.Duration {
+	switch {
+	case resp == nil || p.isBehind(resp) || len(resp.Records) > 0:
+		p.backoff = 0
+	case p.backoff == 0:
+		p.backoff = minPollInterval
+	default:
+		p.backoff = min(p.backoff*2, max(p.cfg.maxInterval, minPollInterval))
+	}
+
+	return max(p.backoff, minPollInterval-elapsed, 0)
+}
+
+func (p *adaptivePollPacer) isBehind(resp *kinesis.GetRecordsOutput) bool {
+	if p.maxRecords > 0 && int64(len(resp.Records)) >= p.maxRecords {
+		return true
+	}
+	lag := time.Duration(aws.ToInt64(resp.MillisBehindLatest)) * time.Millisecond
+	return lag >= p.cfg.lagThreshold
+}
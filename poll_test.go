@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+func TestAdaptivePollPacer_Delay(t *testing.T) {
+	p := &adaptivePollPacer{
+		cfg:        &adaptivePollingConfig{maxInterval: time.Second, lagThreshold: time.Second},
+		maxRecords: 2,
+	}
+	empty := &kinesis.GetRecordsOutput{MillisBehindLatest: aws.Int64(0)}
+	lagging := &kinesis.GetRecordsOutput{MillisBehindLatest: aws.Int64(5000)}
+	full := &kinesis.GetRecordsOutput{Records: records, MillisBehindLatest: aws.Int64(0)}
+
+	steps := []struct {
+		name    string
+		resp    *kinesis.GetRecordsOutput
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{"lagging polls at shard limit", lagging, 50 * time.Millisecond, 150 * time.Millisecond},
+		{"lagging after slow callback", lagging, time.Second, 0},
+		{"first empty", empty, time.Second, 200 * time.Millisecond},
+		{"second empty", empty, time.Second, 400 * time.Millisecond},
+		{"third empty", empty, time.Second, 800 * time.Millisecond},
+		{"capped at max interval", empty, time.Second, time.Second},
+		{"full response resets", full, time.Second, 0},
+		{"error resets", nil, 0, 200 * time.Millisecond},
+	}
+	for _, step := range steps {
+		if got := p.delay(step.resp, step.elapsed); got != step.want {
+			t.Fatalf("%s: delay = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestScanShard_AdaptivePollingBacksOffOnEmptyResponses(t *testing.T) {
+	var calls int
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			calls++
+			if calls == 3 {
+				return &kinesis.GetRecordsOutput{
+					Records: []types.Record{{Data: []byte("data"), SequenceNumber: aws.String("seq-1")}},
+				}, nil
+			}
+			return &kinesis.GetRecordsOutput{
+				NextShardIterator:  aws.String("next"),
+				MillisBehindLatest: aws.Int64(0),
+			}, nil
+		},
+	}
+
+	c, err := New("myStreamName", WithClient(client), WithAdaptivePolling(2*time.Second))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	start := time.Now()
+	if err := c.ScanShard(context.Background(), "myShard", func(r *Record) error { return nil }); err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	// two empty responses back off 200ms then 400ms before the third call
+	if elapsed := time.Since(start); elapsed < 600*time.Millisecond {
+		t.Fatalf("scan finished after %v, want at least 600ms of backoff", elapsed)
+	}
+	if calls != 3 {
+		t.Fatalf("get records calls = %d, want 3", calls)
+	}
+}
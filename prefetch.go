@@ -0,0 +1,143 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+)
+
+// fetchResult is a GetRecords response queued by a shardFetcher together with
+// the iterator it was read from and the memory it holds. err is set, and the
+// queue closed after it, when the fetcher gave up.
+type fetchResult struct {
+	resp     *kinesis.GetRecordsOutput
+	iterator *string
+	memory   *memoryLease
+	err      error
+}
+
+// shardFetcher reads a shard ahead of the callback into a bounded queue. It
+// owns the shard iterator, refreshing it after failed calls from the sequence
+// number of the last record it fetched.
+type shardFetcher struct {
+	runner        *scanShardRunner
+	iterator      *string
+	fetchedSeqNum string
+	out           chan fetchResult
+}
+
+func newShardFetcher(runner *scanShardRunner, shardIterator *string, lastSeqNum string, size int) *shardFetcher {
+	return &shardFetcher{
+		runner:        runner,
+		iterator:      shardIterator,
+		fetchedSeqNum: lastSeqNum,
+		out:           make(chan fetchResult, size),
+	}
+}
+
+// runPrefetch processes responses queued by a shardFetcher until the shard is
+// closed, the context is done or an error occurs. The fetcher runs with
+// fetchCtx; responses still queued when it is done are dropped.
+func (r *scanShardRunner) runPrefetch(ctx, fetchCtx context.Context, shardIterator *string, lastSeqNum string) error {
+	fetchCtx, cancel := context.WithCancel(fetchCtx)
+	fetcher := newShardFetcher(r, shardIterator, lastSeqNum, r.consumer.prefetch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fetcher.run(fetchCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		for res := range fetcher.out {
+			res.memory.release()
+		}
+	}()
+
+	for res := range fetcher.out {
+		if fetchCtx.Err() != nil {
+			res.memory.release()
+			return nil
+		}
+		if res.err != nil {
+			return res.err
+		}
+
+		next, seqNum, err := r.handleResponse(ctx, res.iterator, lastSeqNum, res.resp, res.memory)
+		res.memory.release()
+		lastSeqNum = seqNum
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *shardFetcher) run(ctx context.Context) {
+	defer close(f.out)
+
+	r := f.runner
+	pacer := r.consumer.newPollPacer()
+	defer pacer.stop()
+	retryAttempt := 0
+
+	for {
+		var err error
+		f.iterator, f.fetchedSeqNum, err = r.waitWhilePaused(ctx, f.iterator, f.fetchedSeqNum)
+		if err != nil {
+			f.send(ctx, fetchResult{err: err})
+			return
+		}
+		if f.iterator == nil {
+			return
+		}
+
+		lease, ok := r.consumer.memory.acquire(ctx, r.consumer.getRecordsReservation())
+		if !ok {
+			return
+		}
+
+		resp, err := r.getRecords(ctx, f.iterator)
+		if err != nil {
+			lease.release()
+			retryAttempt++
+			f.iterator, f.fetchedSeqNum, retryAttempt, err = r.refreshIterator(ctx, f.fetchedSeqNum, err, retryAttempt)
+			if err != nil {
+				f.send(ctx, fetchResult{err: err})
+				return
+			}
+			if f.iterator == nil {
+				return
+			}
+		} else {
+			retryAttempt = 0
+			f.fetchedSeqNum = lastFetchedSeqNum(resp.Records, f.fetchedSeqNum)
+			// the page keeps only its own size while queued
+			lease.shrink(int64(recordsSize(resp.Records)))
+			if !f.send(ctx, fetchResult{resp: resp, iterator: f.iterator, memory: lease}) {
+				lease.release()
+				return
+			}
+			if isShardClosed(resp.NextShardIterator, f.iterator) {
+				return
+			}
+			f.iterator = resp.NextShardIterator
+		}
+
+		if !pacer.wait(ctx, resp) {
+			return
+		}
+	}
+}
+
+func (f *shardFetcher) send(ctx context.Context, res fetchResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case f.out <- res:
+		return true
+	}
+}
@@ -0,0 +1,147 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+func TestScanShard_PrefetchFetchesWhileCallbackRuns(t *testing.T) {
+	fetchedSecond := make(chan struct{})
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter-1")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			switch aws.ToString(params.ShardIterator) {
+			case "iter-1":
+				return &kinesis.GetRecordsOutput{
+					NextShardIterator: aws.String("iter-2"),
+					Records:           []types.Record{{Data: []byte("first"), SequenceNumber: aws.String("seq-1")}},
+				}, nil
+			case "iter-2":
+				close(fetchedSecond)
+				return &kinesis.GetRecordsOutput{
+					Records: []types.Record{{Data: []byte("second"), SequenceNumber: aws.String("seq-2")}},
+				}, nil
+			default:
+				return nil, fmt.Errorf("unexpected shard iterator: %s", aws.ToString(params.ShardIterator))
+			}
+		},
+	}
+
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(client), WithStore(cp), WithPrefetch(1), WithScanInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	var res []string
+	err = c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		if string(r.Data) == "first" {
+			select {
+			case <-fetchedSecond:
+			case <-time.After(time.Second):
+				return fmt.Errorf("second response was not fetched while the callback ran")
+			}
+		}
+		res = append(res, string(r.Data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	if got := fmt.Sprint(res); got != "[first second]" {
+		t.Fatalf("records = %s, want [first second]", got)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "seq-2" {
+		t.Fatalf("checkpoint = %q, want %q", val, "seq-2")
+	}
+}
+
+func TestScanShard_PrefetchRefreshesExpiredIteratorFromLastFetchedRecord(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		startingSeq []string
+	)
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			startingSeq = append(startingSeq, aws.ToString(params.StartingSequenceNumber))
+			if len(startingSeq) == 1 {
+				return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter-1")}, nil
+			}
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter-refreshed")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			switch aws.ToString(params.ShardIterator) {
+			case "iter-1":
+				return &kinesis.GetRecordsOutput{
+					NextShardIterator: aws.String("iter-expired"),
+					Records:           []types.Record{{Data: []byte("first"), SequenceNumber: aws.String("seq-1")}},
+				}, nil
+			case "iter-expired":
+				return nil, &types.ExpiredIteratorException{Message: aws.String("expired")}
+			case "iter-refreshed":
+				return &kinesis.GetRecordsOutput{
+					Records: []types.Record{{Data: []byte("second"), SequenceNumber: aws.String("seq-2")}},
+				}, nil
+			default:
+				return nil, fmt.Errorf("unexpected shard iterator: %s", aws.ToString(params.ShardIterator))
+			}
+		},
+	}
+
+	c, err := New("myStreamName", WithClient(client), WithPrefetch(2), WithScanInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	var res []string
+	if err := c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		res = append(res, string(r.Data))
+		return nil
+	}); err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	if got := fmt.Sprint(res); got != "[first second]" {
+		t.Fatalf("records = %s, want [first second]", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := fmt.Sprint(startingSeq); got != "[ seq-1]" {
+		t.Fatalf("iterator starting sequence numbers = %s, want [ seq-1]", got)
+	}
+}
+
+func TestScanShard_PrefetchReturnsFetchError(t *testing.T) {
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			return nil, &types.ResourceNotFoundException{Message: aws.String("gone")}
+		},
+	}
+
+	c, err := New("myStreamName", WithClient(client), WithPrefetch(1))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	err = c.ScanShard(context.Background(), "myShard", func(r *Record) error { return nil })
+	if err == nil {
+		t.Fatal("expected get records error")
+	}
+}
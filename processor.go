@@ -0,0 +1,151 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ShardRecordProcessor processes the records of one shard and is told when
+// the shard starts and stops, like the record processor of the Kinesis Client
+// Library. ScanProcessor creates one per shard it reads and calls it from that
+// shard's goroutine only.
+type ShardRecordProcessor interface {
+	// Initialize is called before the shard is read. startingSequenceNumber
+	// is the checkpoint the shard resumes after, or empty when it starts at
+	// the initial position. An error stops the scan.
+	Initialize(shardID, startingSequenceNumber string) error
+	// ProcessRecords is called with the records of each GetRecords page or
+	// enhanced fan-out event. They are only checkpointed through the
+	// checkpointer. An error stops the scan.
+	ProcessRecords(records []*Record, checkpointer *Checkpointer) error
+	// LeaseLost is called when the consumer group assigned the shard to
+	// another consumer. Its records can no longer be checkpointed; the
+	// checkpointer returns ErrShardReleased.
+	LeaseLost()
+	// ShardEnded is called once the shard has been read to its end. The shard
+	// is closed, releasing its child shards, when it returns nil, so it should
+	// checkpoint first. An error stops the scan.
+	ShardEnded(checkpointer *Checkpointer) error
+	// ShutdownRequested is called when the consumer stops reading the shard
+	// before its end, on Shutdown or when the scan's context is cancelled.
+	// The checkpointer returns ErrShardReleased once it returns.
+	ShutdownRequested(checkpointer *Checkpointer) error
+}
+
+// ShardRecordProcessorFactory creates the processor of a shard.
+type ShardRecordProcessorFactory func(shardID string) ShardRecordProcessor
+
+// ScanProcessor reads every shard with a ShardRecordProcessor from factory.
+// Records are handed over a page at a time and checkpointed only when the
+// processor calls its Checkpointer. Middleware wraps each ProcessRecords call
+// and is given the first record of the page. With a consumer group, LeaseLost and
+// ShutdownRequested are called before the shard's lease is released, and
+// ShardEnded before the shard is closed.
+func (c *Consumer) ScanProcessor(ctx context.Context, factory ShardRecordProcessorFactory) error {
+	if factory == nil {
+		return errors.New("processor factory is required")
+	}
+	if c.partitionKeyConcurrency > 1 {
+		return errors.New("partition key concurrency is not supported with ScanProcessor")
+	}
+
+	r := &scanProcessorRunner{
+		consumer: c,
+		factory:  factory,
+		shards:   make(map[string]*shardProcessor),
+	}
+	return c.scan(ctx, func(context.Context) ScanFunc {
+		return r.handle
+	}, shardHooks{start: r.start, beforeClose: r.beforeClose})
+}
+
+type scanProcessorRunner struct {
+	consumer *Consumer
+	factory  ShardRecordProcessorFactory
+
+	mu     sync.Mutex
+	shards map[string]*shardProcessor
+}
+
+// shardProcessor is the processor of a shard with the records of the page
+// being read.
+type shardProcessor struct {
+	processor    ShardRecordProcessor
+	checkpointer *Checkpointer
+	page         []*Record
+}
+
+func (r *scanProcessorRunner) start(ctx context.Context, shardID string) error {
+	startSeqNum, err := r.consumer.group.GetCheckpoint(r.consumer.streamName, shardID)
+	if err != nil {
+		return fmt.Errorf("get checkpoint error: %w", err)
+	}
+
+	p := &shardProcessor{
+		processor:    r.factory(shardID),
+		checkpointer: newCheckpointer(r.consumer, shardID, startSeqNum),
+	}
+	r.mu.Lock()
+	r.shards[shardID] = p
+	r.mu.Unlock()
+
+	if err := p.processor.Initialize(shardID, startSeqNum); err != nil {
+		return fmt.Errorf("initialize error: %w", err)
+	}
+	return nil
+}
+
+// handle collects the records of a page and hands them to the processor with
+// the last one.
+func (r *scanProcessorRunner) handle(record *Record) error {
+	p := r.shard(record.ShardID)
+	p.page = append(p.page, record)
+	if !record.endOfPage {
+		return ErrSkipCheckpoint
+	}
+
+	page := p.page
+	p.page = nil
+	p.checkpointer.deliver(page...)
+	process := r.consumer.applyMiddleware(func(*Record) error {
+		return p.processor.ProcessRecords(page, p.checkpointer)
+	})
+	if err := process(page[0]); err != nil {
+		return err
+	}
+	return ErrSkipCheckpoint
+}
+
+// beforeClose tells the processor why the shard stopped, then releases its
+// checkpointer. Records of a page the scan stopped within are not delivered;
+// they are read again by the next consumer of the shard.
+func (r *scanProcessorRunner) beforeClose(ctx context.Context, shardID string, stop shardStop) error {
+	r.mu.Lock()
+	p := r.shards[shardID]
+	delete(r.shards, shardID)
+	r.mu.Unlock()
+	defer p.checkpointer.release()
+
+	switch stop {
+	case shardLeaseLost:
+		p.processor.LeaseLost()
+	case shardEnded:
+		if err := p.processor.ShardEnded(p.checkpointer); err != nil {
+			return fmt.Errorf("shard ended error: %w", err)
+		}
+	default:
+		if err := p.processor.ShutdownRequested(p.checkpointer); err != nil {
+			return fmt.Errorf("shutdown requested error: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *scanProcessorRunner) shard(shardID string) *shardProcessor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.shards[shardID]
+}
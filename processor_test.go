@@ -0,0 +1,188 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+// recordingProcessor records the calls it receives. The hooks, when set, run
+// at the end of the matching call.
+type recordingProcessor struct {
+	calls             []string
+	onProcess         func(cp *Checkpointer) error
+	onLeaseLost       func()
+	onShardEnded      func(cp *Checkpointer) error
+	onShutdownRequest func(cp *Checkpointer) error
+}
+
+func (p *recordingProcessor) Initialize(shardID, startingSequenceNumber string) error {
+	p.calls = append(p.calls, fmt.Sprintf("initialize %s %q", shardID, startingSequenceNumber))
+	return nil
+}
+
+func (p *recordingProcessor) ProcessRecords(records []*Record, cp *Checkpointer) error {
+	p.calls = append(p.calls, fmt.Sprintf("process %d", len(records)))
+	if p.onProcess != nil {
+		return p.onProcess(cp)
+	}
+	return nil
+}
+
+func (p *recordingProcessor) LeaseLost() {
+	p.calls = append(p.calls, "lease lost")
+	if p.onLeaseLost != nil {
+		p.onLeaseLost()
+	}
+}
+
+func (p *recordingProcessor) ShardEnded(cp *Checkpointer) error {
+	p.calls = append(p.calls, "shard ended")
+	if p.onShardEnded != nil {
+		return p.onShardEnded(cp)
+	}
+	return nil
+}
+
+func (p *recordingProcessor) ShutdownRequested(cp *Checkpointer) error {
+	p.calls = append(p.calls, "shutdown requested")
+	if p.onShutdownRequest != nil {
+		return p.onShutdownRequest(cp)
+	}
+	return nil
+}
+
+// leaseLosingGroup hands out shard contexts that the test cancels to take the
+// shard away.
+type leaseLosingGroup struct {
+	*multiShardRebalanceAwareGroupMock
+	loseLease context.CancelFunc
+}
+
+func (g *leaseLosingGroup) ShardContext(parent context.Context, shardID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	g.loseLease = cancel
+	return ctx, cancel
+}
+
+func TestScanProcessor_ShardEndedCheckpointsAndClosesShard(t *testing.T) {
+	cp := store.New()
+	group := &multiShardRebalanceAwareGroupMock{shards: []string{"myShard"}}
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithGroup(&storeBackedGroup{multiShardRebalanceAwareGroupMock: group, store: cp}))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	processor := &recordingProcessor{
+		onShardEnded: func(checkpointer *Checkpointer) error {
+			defer cancel()
+			return checkpointer.Checkpoint(ctx)
+		},
+	}
+	err = c.ScanProcessor(ctx, func(shardID string) ShardRecordProcessor {
+		return processor
+	})
+	if err != nil {
+		t.Fatalf("scan processor error: %v", err)
+	}
+
+	want := []string{`initialize myShard ""`, "process 2", "shard ended"}
+	if !slices.Equal(processor.calls, want) {
+		t.Fatalf("calls = %q, want %q", processor.calls, want)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want lastSeqNum", val)
+	}
+	if group.closeShardCalls != 1 {
+		t.Fatalf("CloseShard calls = %d, want 1", group.closeShardCalls)
+	}
+}
+
+func TestScanProcessor_LeaseLostSkipsCheckpoint(t *testing.T) {
+	cp := store.New()
+	group := &leaseLosingGroup{multiShardRebalanceAwareGroupMock: &multiShardRebalanceAwareGroupMock{shards: []string{"myShard"}}}
+	c, err := New("myStreamName", WithClient(newOpenShardClient()), WithStore(cp), WithGroup(group), WithScanInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var kept *Checkpointer
+	processor := &recordingProcessor{
+		onProcess: func(checkpointer *Checkpointer) error {
+			kept = checkpointer
+			group.loseLease()
+			return nil
+		},
+		onLeaseLost: cancel,
+	}
+	err = c.ScanProcessor(ctx, func(shardID string) ShardRecordProcessor {
+		return processor
+	})
+	if err != nil {
+		t.Fatalf("scan processor error: %v", err)
+	}
+
+	want := []string{`initialize myShard ""`, "process 2", "lease lost"}
+	if !slices.Equal(processor.calls, want) {
+		t.Fatalf("calls = %q, want %q", processor.calls, want)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "" {
+		t.Fatalf("checkpoint = %q, want none", val)
+	}
+	if group.shardStoppedCalls != 1 || group.closeShardCalls != 0 {
+		t.Fatalf("ShardStopped calls = %d, CloseShard calls = %d; want the shard handed back", group.shardStoppedCalls, group.closeShardCalls)
+	}
+	if err := kept.Checkpoint(context.Background()); !errors.Is(err, ErrShardReleased) {
+		t.Fatalf("checkpoint after lease lost error = %v, want ErrShardReleased", err)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "" {
+		t.Fatalf("checkpoint = %q after lease lost, want none", val)
+	}
+}
+
+func TestScanProcessor_MiddlewareWrapsProcessRecords(t *testing.T) {
+	processor := &recordingProcessor{}
+	tag := func(next ScanFunc) ScanFunc {
+		return func(r *Record) error {
+			processor.calls = append(processor.calls, "middleware "+aws.ToString(r.SequenceNumber))
+			return next(r)
+		}
+	}
+	group := &multiShardRebalanceAwareGroupMock{shards: []string{"myShard"}}
+	c, err := New("myStreamName", WithClient(newSingleShardClient()), WithGroup(group), WithMiddleware(tag))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	processor.onShardEnded = func(*Checkpointer) error {
+		cancel()
+		return nil
+	}
+	err = c.ScanProcessor(ctx, func(shardID string) ShardRecordProcessor {
+		return processor
+	})
+	if err != nil {
+		t.Fatalf("scan processor error: %v", err)
+	}
+
+	want := []string{`initialize myShard ""`, "middleware firstSeqNum", "process 2", "shard ended"}
+	if !slices.Equal(processor.calls, want) {
+		t.Fatalf("calls = %q, want %q", processor.calls, want)
+	}
+}
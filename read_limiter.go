@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// Kinesis per-shard read limits for shared-throughput consumers.
+const (
+	shardReadCallsPerSecond = 5
+	shardReadBytesPerSecond = 2 << 20
+)
+
+// ReadLimiter keeps GetRecords calls within the per-shard read limits of 5
+// calls and 2 MB per second. Share one limiter between every Consumer in the
+// process that reads the same stream so calls are scheduled inside the budget
+// instead of being throttled. Consumers must address the stream the same way,
+// by name or by ARN, for their shards to share a budget.
+type ReadLimiter struct {
+	mu     sync.Mutex
+	shards map[string]*shardReadBudget
+}
+
+// NewReadLimiter returns a limiter with an empty budget history.
+func NewReadLimiter() *ReadLimiter {
+	return &ReadLimiter{shards: make(map[string]*shardReadBudget)}
+}
+
+// shardReadBudget tracks the recent calls and the byte allowance of a shard.
+// bytes may go negative after a large response; further calls wait until it
+// has been refilled.
+type shardReadBudget struct {
+	calls   []time.Time
+	bytes   float64
+	updated time.Time
+}
+
+// Wait blocks until a GetRecords call on the shard fits within the budget and
+// reserves it. It returns the context error if ctx is done first.
+func (l *ReadLimiter) Wait(ctx context.Context, streamName, shardID string) error {
+	delay := l.reserve(streamName, shardID, time.Now())
+	if !waitWithContext(ctx, delay) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Record charges the bytes returned by a GetRecords call against the shard's
+// budget.
+func (l *ReadLimiter) Record(streamName, shardID string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.budget(streamName, shardID, time.Now())
+	b.bytes -= float64(n)
+}
+
+// reserve books the next call slot for the shard and returns how long after
+// now the call may be made.
+func (l *ReadLimiter) reserve(streamName, shardID string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.budget(streamName, shardID, now)
+
+	at := now
+	if b.bytes < 0 {
+		at = now.Add(time.Duration(-b.bytes / shardReadBytesPerSecond * float64(time.Second)))
+	}
+	if len(b.calls) == shardReadCallsPerSecond {
+		if next := b.calls[0].Add(time.Second); next.After(at) {
+			at = next
+		}
+		b.calls = b.calls[1:]
+	}
+	b.calls = append(b.calls, at)
+
+	return at.Sub(now)
+}
+
+// budget returns the shard's budget with its byte allowance refilled up to
+// now. l.mu must be held.
+func (l *ReadLimiter) budget(streamName, shardID string, now time.Time) *shardReadBudget {
+	key := streamName + "/" + shardID
+	b, ok := l.shards[key]
+	if !ok {
+		b = &shardReadBudget{bytes: shardReadBytesPerSecond, updated: now}
+		l.shards[key] = b
+	}
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.bytes = min(b.bytes+elapsed.Seconds()*shardReadBytesPerSecond, shardReadBytesPerSecond)
+		b.updated = now
+	}
+	return b
+}
+
+// recordsSize returns the bytes a GetRecords response counts against the read
+// limit: the data and partition key of each record.
+func recordsSize(records []types.Record) int {
+	var n int
+	for _, r := range records {
+		n += len(r.Data)
+		if r.PartitionKey != nil {
+			n += len(*r.PartitionKey)
+		}
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+func TestReadLimiter_CallsPerSecond(t *testing.T) {
+	l := NewReadLimiter()
+	now := time.Now()
+
+	for i := 0; i < shardReadCallsPerSecond; i++ {
+		if delay := l.reserve("stream", "shard", now); delay != 0 {
+			t.Fatalf("call %d delay = %v, want 0", i+1, delay)
+		}
+	}
+	if delay := l.reserve("stream", "shard", now); delay != time.Second {
+		t.Fatalf("sixth call delay = %v, want 1s", delay)
+	}
+	if delay := l.reserve("stream", "other", now); delay != 0 {
+		t.Fatalf("other shard delay = %v, want 0", delay)
+	}
+}
+
+func TestReadLimiter_BytesPerSecond(t *testing.T) {
+	l := NewReadLimiter()
+	now := time.Now()
+
+	l.reserve("stream", "shard", now)
+	l.mu.Lock()
+	l.budget("stream", "shard", now).bytes -= 6 << 20
+	l.mu.Unlock()
+
+	// 4 MB over budget takes 2s to refill at 2 MB/s
+	if delay := l.reserve("stream", "shard", now); delay != 2*time.Second {
+		t.Fatalf("delay after large response = %v, want 2s", delay)
+	}
+	if delay := l.reserve("stream", "shard", now.Add(3*time.Second)); delay != 0 {
+		t.Fatalf("delay after refill = %v, want 0", delay)
+	}
+}
+
+func TestScan_ReadLimiterSharedAcrossConsumers(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []time.Time
+	)
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iter")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, time.Now())
+			if len(calls) >= 2*shardReadCallsPerSecond {
+				return &kinesis.GetRecordsOutput{
+					Records: []types.Record{{Data: []byte("data"), SequenceNumber: aws.String("seq")}},
+				}, nil
+			}
+			return &kinesis.GetRecordsOutput{NextShardIterator: aws.String("next")}, nil
+		},
+	}
+
+	limiter := NewReadLimiter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		c, err := New("myStreamName", WithClient(client), WithReadLimiter(limiter), WithScanInterval(time.Millisecond))
+		if err != nil {
+			t.Fatalf("new consumer error: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.ScanShard(ctx, "myShard", func(r *Record) error {
+				cancel()
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := shardReadCallsPerSecond; i < len(calls); i++ {
+		if gap := calls[i].Sub(calls[i-shardReadCallsPerSecond]); gap < 990*time.Millisecond {
+			t.Fatalf("calls %d and %d were %v apart, want at least 1s", i-shardReadCallsPerSecond, i, gap)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// Kinesis operations passed to RetryPolicy.
+const (
+	OperationGetRecords       = "GetRecords"
+	OperationGetShardIterator = "GetShardIterator"
+	OperationListShards       = "ListShards"
+)
+
+// RetryPolicy decides whether a failed Kinesis API call is retried. Retry is
+// called with the operation name, the error and the attempt number (starting
+// at 1) and returns the delay before the next attempt, or false to give up and
+// return the error.
+type RetryPolicy interface {
+	Retry(operation string, err error, attempt int) (time.Duration, bool)
+}
+
+// defaultRetryPolicy retries expired iterators and throughput errors on
+// GetRecords and GetShardIterator without an attempt limit, backing off only on
+// throughput errors.
+type defaultRetryPolicy struct{}
+
+func (defaultRetryPolicy) Retry(operation string, err error, attempt int) (time.Duration, bool) {
+	if operation == OperationListShards || !isRetriableError(err) {
+		return 0, false
+	}
+	return retryDelay(err, attempt), true
+}
+
+// BackoffRetryPolicyOption customizes a BackoffRetryPolicy.
+type BackoffRetryPolicyOption func(*BackoffRetryPolicy)
+
+// WithRetryMaxAttempts sets how many times a call is attempted in total before
+// the error is returned. Zero means no limit.
+func WithRetryMaxAttempts(n int) BackoffRetryPolicyOption {
+	return func(p *BackoffRetryPolicy) {
+		p.maxAttempts = n
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry and the ceiling the
+// exponential backoff is capped at.
+func WithRetryBackoff(base, max time.Duration) BackoffRetryPolicyOption {
+	return func(p *BackoffRetryPolicy) {
+		p.baseDelay = base
+		p.maxDelay = max
+	}
+}
+
+// WithRetryClassifier overrides which errors are retried. The default is
+// IsRetryableError.
+func WithRetryClassifier(retryable func(operation string, err error) bool) BackoffRetryPolicyOption {
+	return func(p *BackoffRetryPolicy) {
+		p.retryable = retryable
+	}
+}
+
+// BackoffRetryPolicy retries classified errors with jittered exponential
+// backoff. Each delay is drawn from the upper half of the current backoff
+// window, so concurrent shards do not retry in lockstep.
+type BackoffRetryPolicy struct {
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+	retryable   func(operation string, err error) bool
+}
+
+// NewBackoffRetryPolicy returns a policy that retries errors matched by
+// IsRetryableError up to 10 attempts, backing off from 200ms to 5s.
+func NewBackoffRetryPolicy(opts ...BackoffRetryPolicyOption) *BackoffRetryPolicy {
+	p := &BackoffRetryPolicy{
+		baseDelay:   getRecordsRetryBaseDelay,
+		maxDelay:    getRecordsRetryMaxDelay,
+		maxAttempts: 10,
+		retryable: func(_ string, err error) bool {
+			return IsRetryableError(err)
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *BackoffRetryPolicy) Retry(operation string, err error, attempt int) (time.Duration, bool) {
+	if p.maxAttempts > 0 && attempt >= p.maxAttempts {
+		return 0, false
+	}
+	if !p.retryable(operation, err) {
+		return 0, false
+	}
+
+	delay := exponentialDelay(p.baseDelay, p.maxDelay, attempt)
+	if delay <= 0 {
+		return 0, true
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1), true
+}
+
+// IsRetryableError reports whether err is a transient Kinesis or network
+// failure: expired iterators, throughput and KMS throttling, internal failures,
+// limit errors, timeouts and dropped connections.
+func IsRetryableError(err error) bool {
+	if isRetriableError(err) {
+		return true
+	}
+
+	var (
+		kmsThrottling *types.KMSThrottlingException
+		internal      *types.InternalFailureException
+		limit         *types.LimitExceededException
+	)
+	switch {
+	case errors.As(err, &kmsThrottling), errors.As(err, &internal), errors.As(err, &limit):
+		return true
+	}
+
+	return isNetworkError(err)
+}
+
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
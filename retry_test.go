@@ -0,0 +1,175 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&types.ProvisionedThroughputExceededException{}, true},
+		{&types.ExpiredIteratorException{}, true},
+		{&types.KMSThrottlingException{}, true},
+		{&types.InternalFailureException{}, true},
+		{&types.LimitExceededException{}, true},
+		{fmt.Errorf("send request: %w", timeoutError{}), true},
+		{&types.ResourceNotFoundException{}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryableError(tt.err); got != tt.want {
+			t.Errorf("IsRetryableError(%T) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffRetryPolicy_JitteredExponentialBackoff(t *testing.T) {
+	p := NewBackoffRetryPolicy(WithRetryBackoff(100*time.Millisecond, time.Second))
+	err := &types.KMSThrottlingException{}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 6: time.Second} {
+		delay, ok := p.Retry(OperationGetRecords, err, attempt)
+		if !ok {
+			t.Fatalf("attempt %d not retried", attempt)
+		}
+		if delay < want/2 || delay > want {
+			t.Fatalf("attempt %d delay = %v, want within [%v, %v]", attempt, delay, want/2, want)
+		}
+	}
+}
+
+func TestBackoffRetryPolicy_MaxAttemptsAndClassification(t *testing.T) {
+	p := NewBackoffRetryPolicy(WithRetryMaxAttempts(3))
+	if _, ok := p.Retry(OperationGetRecords, &types.InternalFailureException{}, 2); !ok {
+		t.Fatal("expected retry before max attempts")
+	}
+	if _, ok := p.Retry(OperationGetRecords, &types.InternalFailureException{}, 3); ok {
+		t.Fatal("expected no retry at max attempts")
+	}
+	if _, ok := p.Retry(OperationGetRecords, errors.New("boom"), 1); ok {
+		t.Fatal("expected no retry for unclassified error")
+	}
+
+	p = NewBackoffRetryPolicy(WithRetryClassifier(func(operation string, err error) bool {
+		return operation == OperationListShards
+	}))
+	if _, ok := p.Retry(OperationListShards, errors.New("boom"), 1); !ok {
+		t.Fatal("expected custom classifier to retry ListShards")
+	}
+	if _, ok := p.Retry(OperationGetRecords, &types.InternalFailureException{}, 1); ok {
+		t.Fatal("expected custom classifier to reject GetRecords")
+	}
+}
+
+func TestScanShard_RetryPolicyRetriesInternalFailure(t *testing.T) {
+	var getRecordsCalls int
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			getRecordsCalls++
+			if getRecordsCalls == 1 {
+				return nil, &types.InternalFailureException{Message: aws.String("internal failure")}
+			}
+			return &kinesis.GetRecordsOutput{Records: records}, nil
+		},
+	}
+
+	c, err := New("myStreamName", WithClient(client), WithRetryPolicy(NewBackoffRetryPolicy()))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	var waits []time.Duration
+	c.retryWait = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return true
+	}
+
+	var count int
+	if err := c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("record count = %d, want 2", count)
+	}
+	if len(waits) != 1 || waits[0] <= 0 {
+		t.Fatalf("retry waits = %v, want one positive backoff", waits)
+	}
+}
+
+func TestScanShard_DefaultRetryPolicyDoesNotRetryInternalFailure(t *testing.T) {
+	client := &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			return nil, &types.InternalFailureException{Message: aws.String("internal failure")}
+		},
+	}
+
+	c, err := New("myStreamName", WithClient(client))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	err = c.ScanShard(context.Background(), "myShard", func(r *Record) error { return nil })
+	var internal *types.InternalFailureException
+	if !errors.As(err, &internal) {
+		t.Fatalf("scan shard error = %v, want InternalFailureException", err)
+	}
+}
+
+func TestScan_RetryPolicyRetriesListShards(t *testing.T) {
+	var listShardsCalls int
+	client := newSingleShardClient()
+	listShards := client.listShardsMock
+	client.listShardsMock = func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+		listShardsCalls++
+		if listShardsCalls == 1 {
+			return nil, &types.LimitExceededException{Message: aws.String("rate exceeded")}
+		}
+		return listShards(ctx, params, optFns...)
+	}
+
+	c, err := New("myStreamName",
+		WithClient(client),
+		WithRetryPolicy(NewBackoffRetryPolicy(WithRetryBackoff(time.Millisecond, time.Millisecond))),
+	)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = c.Scan(ctx, func(r *Record) error {
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+	if listShardsCalls < 2 {
+		t.Fatalf("list shards calls = %d, want a retry", listShardsCalls)
+	}
+}
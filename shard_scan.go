@@ -7,6 +7,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 )
 
 type scanShardRunner struct {
@@ -29,33 +30,65 @@ func (r *scanShardRunner) run(ctx context.Context) error {
 		return err
 	}
 
-	shardIterator, lastSeqNum, err := r.loadIterator(ctx, lastSeqNum)
+	shardIterator, lastSeqNum, _, err := r.loadIteratorWithRetry(ctx, lastSeqNum, 0)
 	if err != nil {
 		return err
 	}
+	if shardIterator == nil {
+		return nil
+	}
 
 	r.consumer.logger.Log("[CONSUMER] start scan:", r.shardID, lastSeqNum)
 	defer func() {
 		r.consumer.logger.Log("[CONSUMER] stop scan:", r.shardID)
 	}()
 
-	scanTicker := time.NewTicker(r.consumer.scanInterval)
-	defer scanTicker.Stop()
+	// fetching stops on Shutdown; a page already fetched is processed with ctx
+	fetchCtx, stopFetching := r.consumer.fetchContext(ctx)
+	defer stopFetching()
+
+	if r.consumer.prefetch > 0 {
+		return r.runPrefetch(ctx, fetchCtx, shardIterator, lastSeqNum)
+	}
+
+	pacer := r.consumer.newPollPacer()
+	defer pacer.stop()
 	retryAttempt := 0
+	// a paused shard renews its iterator after the last record fetched, which
+	// is ahead of lastSeqNum when records are not checkpointed as they are
+	// processed
+	fetchedSeqNum := lastSeqNum
 
 	for {
-		resp, err := r.getRecords(ctx, shardIterator)
+		shardIterator, fetchedSeqNum, err = r.waitWhilePaused(fetchCtx, shardIterator, fetchedSeqNum)
+		if err != nil {
+			return err
+		}
+		if shardIterator == nil {
+			return nil
+		}
+
+		lease, ok := r.consumer.memory.acquire(fetchCtx, r.consumer.getRecordsReservation())
+		if !ok {
+			return nil
+		}
+
+		resp, err := r.getRecords(fetchCtx, shardIterator)
 		if err != nil {
+			lease.release()
 			retryAttempt++
-			shardIterator, lastSeqNum, retryAttempt, err = r.refreshIterator(ctx, lastSeqNum, err, retryAttempt)
+			shardIterator, lastSeqNum, retryAttempt, err = r.refreshIterator(fetchCtx, lastSeqNum, err, retryAttempt)
 			if err != nil {
 				return err
 			}
+			fetchedSeqNum = lastSeqNum
 			if shardIterator == nil {
 				return nil
 			}
 		} else {
-			shardIterator, lastSeqNum, err = r.handleResponse(ctx, shardIterator, lastSeqNum, resp)
+			fetchedSeqNum = lastFetchedSeqNum(resp.Records, fetchedSeqNum)
+			shardIterator, lastSeqNum, err = r.handleResponse(ctx, shardIterator, lastSeqNum, resp, lease)
+			lease.release()
 			if err != nil {
 				return err
 			}
@@ -65,7 +98,7 @@ func (r *scanShardRunner) run(ctx context.Context) error {
 			retryAttempt = 0
 		}
 
-		if !r.waitForNextPoll(ctx, scanTicker) {
+		if !pacer.wait(fetchCtx, resp) {
 			return nil
 		}
 	}
@@ -88,10 +121,27 @@ func (r *scanShardRunner) loadIterator(ctx context.Context, lastSeqNum string) (
 }
 
 func (r *scanShardRunner) getRecords(ctx context.Context, shardIterator *string) (*kinesis.GetRecordsOutput, error) {
-	return r.consumer.client.GetRecords(ctx, &kinesis.GetRecordsInput{
+	limiter := r.consumer.readLimiter
+	if limiter != nil {
+		if err := limiter.Wait(ctx, r.consumer.streamName, r.shardID); err != nil {
+			return nil, err
+		}
+	}
+
+	_, streamARN := streamParams(r.consumer.streamName)
+	resp, err := r.consumer.client.GetRecords(ctx, &kinesis.GetRecordsInput{
 		Limit:         aws.Int32(int32(r.consumer.maxRecords)),
 		ShardIterator: shardIterator,
+		StreamARN:     streamARN,
 	}, r.consumer.getRecordsOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if limiter != nil {
+		limiter.Record(r.consumer.streamName, r.shardID, recordsSize(resp.Records))
+	}
+	return resp, nil
 }
 
 func (r *scanShardRunner) refreshIterator(ctx context.Context, lastSeqNum string, getRecordsErr error, attempt int) (*string, string, int, error) {
@@ -101,44 +151,86 @@ func (r *scanShardRunner) refreshIterator(ctx context.Context, lastSeqNum string
 		return nil, lastSeqNum, attempt, nil
 	}
 
-	if !isRetriableError(getRecordsErr) {
+	delay, ok := r.consumer.retryPolicy.Retry(OperationGetRecords, getRecordsErr, attempt)
+	if !ok {
 		return nil, lastSeqNum, attempt, fmt.Errorf("get records error: %w", getRecordsErr)
 	}
 
-	if !r.waitForRetry(ctx, getRecordsErr, attempt, "get records") {
+	if !r.waitForRetry(ctx, delay, attempt, "get records") {
 		return nil, lastSeqNum, attempt, nil
 	}
 
+	return r.loadIteratorWithRetry(ctx, lastSeqNum, attempt)
+}
+
+// loadIteratorWithRetry gets a shard iterator, retrying failures the retry
+// policy allows. attempt counts the consecutive failures so far. A nil iterator
+// without an error means the context was cancelled while waiting.
+func (r *scanShardRunner) loadIteratorWithRetry(ctx context.Context, lastSeqNum string, attempt int) (*string, string, int, error) {
 	for {
 		shardIterator, nextSeqNum, err := r.loadIterator(ctx, lastSeqNum)
 		if err == nil {
 			return shardIterator, nextSeqNum, attempt, nil
 		}
-		if !isRetriableError(err) {
+
+		attempt++
+		delay, ok := r.consumer.retryPolicy.Retry(OperationGetShardIterator, err, attempt)
+		if !ok || ctx.Err() != nil {
 			return nil, lastSeqNum, attempt, err
 		}
 
-		attempt++
 		r.consumer.logger.Log("[CONSUMER] get shard iterator retry:", r.shardID, attempt, err)
-		if !r.waitForRetry(ctx, err, attempt, "get shard iterator") {
+		if !r.waitForRetry(ctx, delay, attempt, "get shard iterator") {
 			return nil, lastSeqNum, attempt, nil
 		}
 	}
 }
 
-func (r *scanShardRunner) handleResponse(ctx context.Context, shardIterator *string, lastSeqNum string, resp *kinesis.GetRecordsOutput) (*string, string, error) {
-	records, err := r.consumer.normalizeRecords(resp.Records)
+// waitWhilePaused blocks while the shard is paused, renewing the iterator
+// after fetchedSeqNum, the last record fetched, so it does not expire. The
+// iterator is nil when ctx is done.
+func (r *scanShardRunner) waitWhilePaused(ctx context.Context, shardIterator *string, fetchedSeqNum string) (*string, string, error) {
+	ok, err := r.consumer.waitWhilePaused(ctx, r.shardID, func() error {
+		next, seqNum, _, err := r.loadIteratorWithRetry(ctx, fetchedSeqNum, 0)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if next != nil {
+			shardIterator, fetchedSeqNum = next, seqNum
+		}
+		return nil
+	})
+	if err != nil || !ok {
+		return nil, fetchedSeqNum, err
+	}
+	return shardIterator, fetchedSeqNum, nil
+}
+
+// lastFetchedSeqNum returns the sequence number of the last of records, or
+// fetchedSeqNum when there are none.
+func lastFetchedSeqNum(records []types.Record, fetchedSeqNum string) string {
+	if n := len(records); n > 0 {
+		return aws.ToString(records[n-1].SequenceNumber)
+	}
+	return fetchedSeqNum
+}
+
+// handleResponse processes a page of records read with the memory lease,
+// which the caller releases afterwards.
+func (r *scanShardRunner) handleResponse(ctx context.Context, shardIterator *string, lastSeqNum string, resp *kinesis.GetRecordsOutput, lease *memoryLease) (*string, string, error) {
+	lease.shrink(int64(recordsSize(resp.Records)))
+	records, err := r.consumer.normalizeRecords(ctx, r.shardID, resp.Records)
 	if err != nil {
 		return nil, lastSeqNum, err
 	}
 
-	lastSeqNum, err = r.consumer.processRecords(ctx, r.shardID, records, resp.MillisBehindLatest, r.fn, lastSeqNum)
+	lastSeqNum, err = r.consumer.processRecords(ctx, r.shardID, records, resp.MillisBehindLatest, lease.bind(r.fn), lastSeqNum)
 	if err != nil {
 		return nil, lastSeqNum, err
 	}
 
 	if isShardClosed(resp.NextShardIterator, shardIterator) {
-		if err := r.handleShardClosed(); err != nil {
+		if err := r.consumer.handleShardClosed(r.shardID); err != nil {
 			return nil, lastSeqNum, err
 		}
 		return nil, lastSeqNum, nil
@@ -147,29 +239,7 @@ func (r *scanShardRunner) handleResponse(ctx context.Context, shardIterator *str
 	return resp.NextShardIterator, lastSeqNum, nil
 }
 
-func (r *scanShardRunner) handleShardClosed() error {
-	r.consumer.logger.Log("[CONSUMER] shard closed:", r.shardID)
-
-	if r.consumer.shardClosedHandler == nil {
-		return nil
-	}
-	if err := r.consumer.shardClosedHandler(r.consumer.streamName, r.shardID); err != nil {
-		return fmt.Errorf("shard closed handler error: %w", err)
-	}
-	return nil
-}
-
-func (r *scanShardRunner) waitForNextPoll(ctx context.Context, scanTicker *time.Ticker) bool {
-	select {
-	case <-ctx.Done():
-		return false
-	case <-scanTicker.C:
-		return true
-	}
-}
-
-func (r *scanShardRunner) waitForRetry(ctx context.Context, err error, attempt int, operation string) bool {
-	delay := retryDelay(err, attempt)
+func (r *scanShardRunner) waitForRetry(ctx context.Context, delay time.Duration, attempt int, operation string) bool {
 	if delay <= 0 {
 		return ctx.Err() == nil
 	}
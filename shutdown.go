@@ -0,0 +1,190 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DrainError is returned by Shutdown when shards were still being processed
+// at its deadline. Their scans are cancelled and their unprocessed records
+// are read again by the next consumer of the shard.
+type DrainError struct {
+	Shards []string
+	Err    error
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("shards did not drain: %s: %v", strings.Join(e.Shards, ", "), e.Err)
+}
+
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown stops every scan of the consumer gracefully. Shards stop fetching
+// records, the records already fetched are handed to the callback, ScanBatch
+// and ScanAck flush and acknowledge what they hold, checkpoints are flushed,
+// and consumer-group leases are released. Scans return nil once drained.
+//
+// If ctx is done first, the remaining scans are cancelled as if their context
+// had been, checkpoints are flushed, and a *DrainError lists the shards that
+// had not drained. Scans started after Shutdown return immediately.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	idle := c.shutdown.begin(ctx)
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	drainErr := &DrainError{Shards: c.shutdown.activeShards(), Err: ctx.Err()}
+	c.shutdown.cancelScans()
+	if err := c.flushCheckpoints(); err != nil {
+		return fmt.Errorf("checkpoint flush error: %w: %w", err, drainErr)
+	}
+	return drainErr
+}
+
+// shutdownState tracks the running scans of a consumer and the shards they
+// read so Shutdown can drain them.
+type shutdownState struct {
+	initOnce sync.Once
+	stopCtx  context.Context
+	stop     context.CancelFunc
+
+	mu       sync.Mutex
+	drainCtx context.Context
+	nextID   int
+	scans    map[int]context.CancelFunc
+	shards   map[string]int
+	idle     chan struct{}
+}
+
+func (s *shutdownState) init() {
+	s.initOnce.Do(func() {
+		s.stopCtx, s.stop = context.WithCancel(context.Background())
+		s.scans = make(map[int]context.CancelFunc)
+		s.shards = make(map[string]int)
+		s.idle = make(chan struct{})
+	})
+}
+
+// stopped returns a context that is done once Shutdown has been called.
+func (s *shutdownState) stopped() context.Context {
+	s.init()
+	return s.stopCtx
+}
+
+// begin stops the scans and returns a channel closed once none is running.
+func (s *shutdownState) begin(ctx context.Context) <-chan struct{} {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.drainCtx == nil {
+		s.drainCtx = ctx
+		s.stop()
+		if len(s.scans) == 0 {
+			close(s.idle)
+		}
+	}
+	return s.idle
+}
+
+// drainContext returns the context given to Shutdown, bounding the final
+// flushes of a draining scan, or context.Background before Shutdown.
+func (s *shutdownState) drainContext() context.Context {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.drainCtx == nil {
+		return context.Background()
+	}
+	return s.drainCtx
+}
+
+// startScan registers a scan that cancel stops. ok is false after Shutdown.
+func (s *shutdownState) startScan(cancel context.CancelFunc) (id int, ok bool) {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.drainCtx != nil {
+		return 0, false
+	}
+	s.nextID++
+	s.scans[s.nextID] = cancel
+	return s.nextID, true
+}
+
+func (s *shutdownState) endScan(id int) {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.scans, id)
+	if s.drainCtx != nil && len(s.scans) == 0 {
+		select {
+		case <-s.idle:
+		default:
+			close(s.idle)
+		}
+	}
+}
+
+func (s *shutdownState) cancelScans() {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cancel := range s.scans {
+		cancel()
+	}
+}
+
+func (s *shutdownState) startShard(shardID string) {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shards[shardID]++
+}
+
+func (s *shutdownState) endShard(shardID string) {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shards[shardID]--; s.shards[shardID] <= 0 {
+		delete(s.shards, shardID)
+	}
+}
+
+func (s *shutdownState) activeShards() []string {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shards := make([]string, 0, len(s.shards))
+	for shardID := range s.shards {
+		shards = append(shards, shardID)
+	}
+	slices.Sort(shards)
+	return shards
+}
+
+// fetchContext returns a context for fetching records from a shard, done once
+// ctx is or Shutdown has been called. Records already fetched are processed
+// with ctx so Shutdown does not interrupt a page.
+func (c *Consumer) fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(c.shutdown.stopped(), cancel)
+	return fetchCtx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,183 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+// newOpenShardClient returns a client whose single shard yields records on the
+// first call and stays open, with no further records, afterwards.
+func newOpenShardClient() *kinesisClientMock {
+	var calls int
+	return &kinesisClientMock{
+		getShardIteratorMock: func(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+			return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+		},
+		getRecordsMock: func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+			calls++
+			if calls == 1 {
+				return &kinesis.GetRecordsOutput{NextShardIterator: aws.String("next"), Records: records}, nil
+			}
+			return &kinesis.GetRecordsOutput{NextShardIterator: aws.String("next")}, nil
+		},
+		listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+			return &kinesis.ListShardsOutput{Shards: []types.Shard{{ShardId: aws.String("myShard")}}}, nil
+		},
+	}
+}
+
+func TestShutdown_DrainsInFlightPage(t *testing.T) {
+	cp := store.New()
+	group := &multiShardRebalanceAwareGroupMock{shards: []string{"myShard"}}
+	c, err := New("myStreamName", WithClient(newOpenShardClient()), WithStore(cp), WithGroup(group), WithScanInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	// checkpoints go through the group; keep them in the store
+	c.group = &storeBackedGroup{multiShardRebalanceAwareGroupMock: group, store: cp}
+
+	shutdownErr := make(chan error, 1)
+	var processed []string
+	err = c.Scan(context.Background(), func(r *Record) error {
+		processed = append(processed, aws.ToString(r.SequenceNumber))
+		if len(processed) == 1 {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				shutdownErr <- c.Shutdown(ctx)
+			}()
+			<-c.shutdown.stopped().Done()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+
+	if len(processed) != 2 {
+		t.Fatalf("processed = %v, want the whole page", processed)
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want lastSeqNum", val)
+	}
+	if group.shardStoppedCalls != 1 || group.closeShardCalls != 0 {
+		t.Fatalf("ShardStopped calls = %d, CloseShard calls = %d; want the shard handed back", group.shardStoppedCalls, group.closeShardCalls)
+	}
+
+	if err := c.Scan(context.Background(), func(r *Record) error { return nil }); err != nil {
+		t.Fatalf("scan after shutdown error: %v", err)
+	}
+}
+
+func TestShutdown_ReportsShardsThatDidNotDrain(t *testing.T) {
+	cp := store.New()
+	c, err := New("myStreamName", WithClient(newOpenShardClient()), WithStore(cp))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	scanErr := make(chan error, 1)
+	go func() {
+		scanErr <- c.Scan(context.Background(), func(r *Record) error {
+			if aws.ToString(r.SequenceNumber) == "lastSeqNum" {
+				close(started)
+				<-release
+			}
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.Shutdown(ctx)
+
+	var drainErr *DrainError
+	if !errors.As(err, &drainErr) || len(drainErr.Shards) != 1 || drainErr.Shards[0] != "myShard" {
+		t.Fatalf("shutdown error = %v, want myShard not drained", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown error = %v, want deadline exceeded", err)
+	}
+
+	close(release)
+	if err := <-scanErr; err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+}
+
+func TestShutdown_FlushesScanBatchBuffers(t *testing.T) {
+	cp := store.New()
+	client := newOpenShardClient()
+	// the page has been buffered once the next one is fetched
+	buffered := make(chan struct{})
+	var (
+		calls      int
+		getRecords = client.getRecordsMock
+	)
+	client.getRecordsMock = func(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+		calls++
+		if calls == 2 {
+			close(buffered)
+		}
+		return getRecords(ctx, params, optFns...)
+	}
+	c, err := New("myStreamName", WithClient(client), WithStore(cp), WithScanInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	scanErr := make(chan error, 1)
+	batches := make(chan []*Record, 1)
+	go func() {
+		scanErr <- c.ScanBatch(context.Background(), func(batch []*Record) error {
+			batches <- batch
+			return nil
+		}, WithBatchMaxSize(100), WithBatchFlushInterval(time.Hour))
+	}()
+
+	<-buffered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+	if err := <-scanErr; err != nil {
+		t.Fatalf("scan batch error: %v", err)
+	}
+
+	if batch := <-batches; len(batch) != len(records) {
+		t.Fatalf("flushed batch size = %d, want %d", len(batch), len(records))
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want lastSeqNum", val)
+	}
+}
+
+// storeBackedGroup keeps the checkpoints of a group mock in a store.
+type storeBackedGroup struct {
+	*multiShardRebalanceAwareGroupMock
+	store Store
+}
+
+func (g *storeBackedGroup) GetCheckpoint(streamName, shardID string) (string, error) {
+	return g.store.GetCheckpoint(streamName, shardID)
+}
+
+func (g *storeBackedGroup) SetCheckpoint(streamName, shardID, sequenceNumber string) error {
+	return g.store.SetCheckpoint(streamName, shardID, sequenceNumber)
+}
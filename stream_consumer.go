@@ -0,0 +1,217 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+var (
+	// ErrStreamConsumerConflict is matched by registration errors caused by a
+	// stream consumer with the same name that cannot be used, e.g. one that is
+	// being deleted.
+	ErrStreamConsumerConflict = errors.New("stream consumer conflict")
+
+	// ErrStreamConsumerLimitExceeded is matched by registration errors caused by
+	// the per-stream consumer limit or the control-plane rate limit.
+	ErrStreamConsumerLimitExceeded = errors.New("stream consumer limit exceeded")
+)
+
+// StreamConsumerError is returned when registering, discovering, or
+// deregistering an enhanced fan-out stream consumer fails. Use errors.Is with
+// ErrStreamConsumerConflict or ErrStreamConsumerLimitExceeded to classify it.
+type StreamConsumerError struct {
+	Op           string
+	ConsumerName string
+	Kind         error
+	Err          error
+}
+
+func (e *StreamConsumerError) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("%s stream consumer %q: %v", e.Op, e.ConsumerName, e.Err)
+	}
+	return fmt.Sprintf("%s stream consumer %q: %v: %v", e.Op, e.ConsumerName, e.Kind, e.Err)
+}
+
+func (e *StreamConsumerError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// StreamConsumerOption customizes stream consumer registration.
+type StreamConsumerOption func(*streamConsumerConfig)
+
+type streamConsumerConfig struct {
+	name             string
+	deregisterOnExit bool
+	activeTimeout    time.Duration
+	pollInterval     time.Duration
+}
+
+// WithStreamConsumerDeregistration deregisters the stream consumer when Scan
+// returns. Leave this off when several processes share the registration.
+func WithStreamConsumerDeregistration(deregister bool) StreamConsumerOption {
+	return func(cfg *streamConsumerConfig) {
+		cfg.deregisterOnExit = deregister
+	}
+}
+
+// WithStreamConsumerActiveTimeout bounds how long New waits for the stream
+// consumer to become ACTIVE.
+func WithStreamConsumerActiveTimeout(d time.Duration) StreamConsumerOption {
+	return func(cfg *streamConsumerConfig) {
+		cfg.activeTimeout = d
+	}
+}
+
+// WithStreamConsumerPollInterval sets how often the consumer status is polled
+// while waiting for it to become ACTIVE.
+func WithStreamConsumerPollInterval(d time.Duration) StreamConsumerOption {
+	return func(cfg *streamConsumerConfig) {
+		cfg.pollInterval = d
+	}
+}
+
+// streamConsumerClient defines the control-plane calls used to manage an
+// enhanced fan-out stream consumer.
+type streamConsumerClient interface {
+	DescribeStreamSummary(ctx context.Context, params *kinesis.DescribeStreamSummaryInput, optFns ...func(*kinesis.Options)) (*kinesis.DescribeStreamSummaryOutput, error)
+	RegisterStreamConsumer(ctx context.Context, params *kinesis.RegisterStreamConsumerInput, optFns ...func(*kinesis.Options)) (*kinesis.RegisterStreamConsumerOutput, error)
+	DescribeStreamConsumer(ctx context.Context, params *kinesis.DescribeStreamConsumerInput, optFns ...func(*kinesis.Options)) (*kinesis.DescribeStreamConsumerOutput, error)
+	DeregisterStreamConsumer(ctx context.Context, params *kinesis.DeregisterStreamConsumerInput, optFns ...func(*kinesis.Options)) (*kinesis.DeregisterStreamConsumerOutput, error)
+}
+
+// registerStreamConsumer registers the configured stream consumer, or
+// discovers it when it already exists, and waits for it to become ACTIVE.
+func (c *Consumer) registerStreamConsumer(ctx context.Context) (string, error) {
+	cfg := c.streamConsumer
+	client, ok := c.client.(streamConsumerClient)
+	if !ok {
+		return "", errors.New("stream consumer registration requires a client that supports RegisterStreamConsumer")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.activeTimeout)
+	defer cancel()
+
+	streamARN := c.streamName
+	if !isStreamARN(streamARN) {
+		summary, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+			StreamName: aws.String(c.streamName),
+		})
+		if err != nil {
+			return "", fmt.Errorf("describe stream summary error: %w", err)
+		}
+		streamARN = aws.ToString(summary.StreamDescriptionSummary.StreamARN)
+	}
+
+	var description *types.ConsumerDescription
+	out, err := client.RegisterStreamConsumer(ctx, &kinesis.RegisterStreamConsumerInput{
+		StreamARN:    aws.String(streamARN),
+		ConsumerName: aws.String(cfg.name),
+	})
+	switch {
+	case err == nil:
+		c.logger.Log("[CONSUMER] registered stream consumer:", cfg.name)
+		description = &types.ConsumerDescription{
+			ConsumerARN:    out.Consumer.ConsumerARN,
+			ConsumerStatus: out.Consumer.ConsumerStatus,
+		}
+	case isResourceInUseError(err):
+		// the consumer is already registered, reuse it
+		description, err = c.describeStreamConsumer(ctx, client, &kinesis.DescribeStreamConsumerInput{
+			StreamARN:    aws.String(streamARN),
+			ConsumerName: aws.String(cfg.name),
+		})
+		if err != nil {
+			return "", err
+		}
+		c.logger.Log("[CONSUMER] discovered stream consumer:", cfg.name, description.ConsumerStatus)
+	default:
+		return "", c.streamConsumerError("register", err)
+	}
+
+	consumerARN := aws.ToString(description.ConsumerARN)
+	for {
+		switch description.ConsumerStatus {
+		case types.ConsumerStatusActive:
+			return consumerARN, nil
+		case types.ConsumerStatusDeleting:
+			return "", &StreamConsumerError{
+				Op:           "register",
+				ConsumerName: cfg.name,
+				Kind:         ErrStreamConsumerConflict,
+				Err:          errors.New("stream consumer is being deleted"),
+			}
+		}
+
+		if !waitWithContext(ctx, cfg.pollInterval) {
+			return "", fmt.Errorf("stream consumer %q did not become active: %w", cfg.name, ctx.Err())
+		}
+		description, err = c.describeStreamConsumer(ctx, client, &kinesis.DescribeStreamConsumerInput{
+			ConsumerARN: aws.String(consumerARN),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (c *Consumer) describeStreamConsumer(ctx context.Context, client streamConsumerClient, params *kinesis.DescribeStreamConsumerInput) (*types.ConsumerDescription, error) {
+	out, err := client.DescribeStreamConsumer(ctx, params)
+	if err != nil {
+		return nil, c.streamConsumerError("describe", err)
+	}
+	return out.ConsumerDescription, nil
+}
+
+// deregisterStreamConsumer removes the stream consumer registered by New when
+// deregistration on exit was requested.
+func (c *Consumer) deregisterStreamConsumer(ctx context.Context) error {
+	if c.streamConsumer == nil || !c.streamConsumer.deregisterOnExit || c.consumerARN == "" {
+		return nil
+	}
+	client, ok := c.client.(streamConsumerClient)
+	if !ok {
+		return nil
+	}
+
+	_, err := client.DeregisterStreamConsumer(ctx, &kinesis.DeregisterStreamConsumerInput{
+		ConsumerARN: aws.String(c.consumerARN),
+	})
+	if err != nil {
+		return c.streamConsumerError("deregister", err)
+	}
+	c.logger.Log("[CONSUMER] deregistered stream consumer:", c.streamConsumer.name)
+	return nil
+}
+
+func (c *Consumer) streamConsumerError(op string, err error) error {
+	consumerErr := &StreamConsumerError{
+		Op:           op,
+		ConsumerName: c.streamConsumer.name,
+		Err:          err,
+	}
+	if oe := (*types.LimitExceededException)(nil); errors.As(err, &oe) {
+		consumerErr.Kind = ErrStreamConsumerLimitExceeded
+	} else if isResourceInUseError(err) {
+		consumerErr.Kind = ErrStreamConsumerConflict
+	}
+	return consumerErr
+}
+
+func isResourceInUseError(err error) bool {
+	oe := (*types.ResourceInUseException)(nil)
+	return errors.As(err, &oe)
+}
@@ -0,0 +1,182 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+const testStreamARN = "arn:aws:kinesis:us-east-1:123456789012:stream/myStreamName"
+
+type streamConsumerClientMock struct {
+	kinesisClientMock
+	registerMock   func(ctx context.Context, params *kinesis.RegisterStreamConsumerInput) (*kinesis.RegisterStreamConsumerOutput, error)
+	describeMock   func(ctx context.Context, params *kinesis.DescribeStreamConsumerInput) (*kinesis.DescribeStreamConsumerOutput, error)
+	deregisterMock func(ctx context.Context, params *kinesis.DeregisterStreamConsumerInput) (*kinesis.DeregisterStreamConsumerOutput, error)
+}
+
+func (c *streamConsumerClientMock) DescribeStreamSummary(ctx context.Context, params *kinesis.DescribeStreamSummaryInput, optFns ...func(*kinesis.Options)) (*kinesis.DescribeStreamSummaryOutput, error) {
+	return &kinesis.DescribeStreamSummaryOutput{
+		StreamDescriptionSummary: &types.StreamDescriptionSummary{StreamARN: aws.String(testStreamARN)},
+	}, nil
+}
+
+func (c *streamConsumerClientMock) RegisterStreamConsumer(ctx context.Context, params *kinesis.RegisterStreamConsumerInput, optFns ...func(*kinesis.Options)) (*kinesis.RegisterStreamConsumerOutput, error) {
+	return c.registerMock(ctx, params)
+}
+
+func (c *streamConsumerClientMock) DescribeStreamConsumer(ctx context.Context, params *kinesis.DescribeStreamConsumerInput, optFns ...func(*kinesis.Options)) (*kinesis.DescribeStreamConsumerOutput, error) {
+	return c.describeMock(ctx, params)
+}
+
+func (c *streamConsumerClientMock) DeregisterStreamConsumer(ctx context.Context, params *kinesis.DeregisterStreamConsumerInput, optFns ...func(*kinesis.Options)) (*kinesis.DeregisterStreamConsumerOutput, error) {
+	return c.deregisterMock(ctx, params)
+}
+
+func TestNew_StreamConsumerRegistersAndWaitsForActive(t *testing.T) {
+	var describeCalls int
+	client := &streamConsumerClientMock{
+		registerMock: func(ctx context.Context, params *kinesis.RegisterStreamConsumerInput) (*kinesis.RegisterStreamConsumerOutput, error) {
+			if aws.ToString(params.StreamARN) != testStreamARN || aws.ToString(params.ConsumerName) != "app" {
+				t.Fatalf("unexpected register input: %s %s", aws.ToString(params.StreamARN), aws.ToString(params.ConsumerName))
+			}
+			return &kinesis.RegisterStreamConsumerOutput{Consumer: &types.Consumer{
+				ConsumerARN:    aws.String("consumer-arn"),
+				ConsumerStatus: types.ConsumerStatusCreating,
+			}}, nil
+		},
+		describeMock: func(ctx context.Context, params *kinesis.DescribeStreamConsumerInput) (*kinesis.DescribeStreamConsumerOutput, error) {
+			describeCalls++
+			status := types.ConsumerStatusCreating
+			if describeCalls == 2 {
+				status = types.ConsumerStatusActive
+			}
+			return &kinesis.DescribeStreamConsumerOutput{ConsumerDescription: &types.ConsumerDescription{
+				ConsumerARN:    params.ConsumerARN,
+				ConsumerStatus: status,
+			}}, nil
+		},
+	}
+
+	c, err := New("myStreamName",
+		WithClient(client),
+		WithStreamConsumer("app", WithStreamConsumerPollInterval(time.Millisecond)),
+	)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	if c.consumerARN != "consumer-arn" {
+		t.Fatalf("consumer ARN = %q, want %q", c.consumerARN, "consumer-arn")
+	}
+	if describeCalls != 2 {
+		t.Fatalf("describe calls = %d, want 2", describeCalls)
+	}
+}
+
+func TestNew_StreamConsumerDiscoversExistingRegistration(t *testing.T) {
+	client := &streamConsumerClientMock{
+		registerMock: func(ctx context.Context, params *kinesis.RegisterStreamConsumerInput) (*kinesis.RegisterStreamConsumerOutput, error) {
+			return nil, &types.ResourceInUseException{Message: aws.String("consumer exists")}
+		},
+		describeMock: func(ctx context.Context, params *kinesis.DescribeStreamConsumerInput) (*kinesis.DescribeStreamConsumerOutput, error) {
+			if aws.ToString(params.ConsumerName) != "app" {
+				t.Fatalf("describe consumer name = %q, want %q", aws.ToString(params.ConsumerName), "app")
+			}
+			return &kinesis.DescribeStreamConsumerOutput{ConsumerDescription: &types.ConsumerDescription{
+				ConsumerARN:    aws.String("existing-arn"),
+				ConsumerStatus: types.ConsumerStatusActive,
+			}}, nil
+		},
+	}
+
+	c, err := New("myStreamName", WithClient(client), WithStreamConsumer("app"))
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	if c.consumerARN != "existing-arn" {
+		t.Fatalf("consumer ARN = %q, want %q", c.consumerARN, "existing-arn")
+	}
+}
+
+func TestNew_StreamConsumerDeletingIsConflict(t *testing.T) {
+	client := &streamConsumerClientMock{
+		registerMock: func(ctx context.Context, params *kinesis.RegisterStreamConsumerInput) (*kinesis.RegisterStreamConsumerOutput, error) {
+			return nil, &types.ResourceInUseException{Message: aws.String("consumer exists")}
+		},
+		describeMock: func(ctx context.Context, params *kinesis.DescribeStreamConsumerInput) (*kinesis.DescribeStreamConsumerOutput, error) {
+			return &kinesis.DescribeStreamConsumerOutput{ConsumerDescription: &types.ConsumerDescription{
+				ConsumerARN:    aws.String("existing-arn"),
+				ConsumerStatus: types.ConsumerStatusDeleting,
+			}}, nil
+		},
+	}
+
+	_, err := New("myStreamName", WithClient(client), WithStreamConsumer("app"))
+	if !errors.Is(err, ErrStreamConsumerConflict) {
+		t.Fatalf("new consumer error = %v, want %v", err, ErrStreamConsumerConflict)
+	}
+	var consumerErr *StreamConsumerError
+	if !errors.As(err, &consumerErr) || consumerErr.ConsumerName != "app" {
+		t.Fatalf("expected StreamConsumerError for app, got %v", err)
+	}
+}
+
+func TestNew_StreamConsumerLimitExceeded(t *testing.T) {
+	limitErr := &types.LimitExceededException{Message: aws.String("too many consumers")}
+	client := &streamConsumerClientMock{
+		registerMock: func(ctx context.Context, params *kinesis.RegisterStreamConsumerInput) (*kinesis.RegisterStreamConsumerOutput, error) {
+			return nil, limitErr
+		},
+	}
+
+	_, err := New("myStreamName", WithClient(client), WithStreamConsumer("app"))
+	if !errors.Is(err, ErrStreamConsumerLimitExceeded) {
+		t.Fatalf("new consumer error = %v, want %v", err, ErrStreamConsumerLimitExceeded)
+	}
+	if !errors.Is(err, limitErr) {
+		t.Fatalf("new consumer error = %v, want wrapped %v", err, limitErr)
+	}
+}
+
+func TestScan_StreamConsumerDeregistersOnExit(t *testing.T) {
+	var deregistered string
+	client := &streamConsumerClientMock{
+		kinesisClientMock: kinesisClientMock{
+			listShardsMock: func(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+				return &kinesis.ListShardsOutput{}, nil
+			},
+		},
+		registerMock: func(ctx context.Context, params *kinesis.RegisterStreamConsumerInput) (*kinesis.RegisterStreamConsumerOutput, error) {
+			return &kinesis.RegisterStreamConsumerOutput{Consumer: &types.Consumer{
+				ConsumerARN:    aws.String("consumer-arn"),
+				ConsumerStatus: types.ConsumerStatusActive,
+			}}, nil
+		},
+		deregisterMock: func(ctx context.Context, params *kinesis.DeregisterStreamConsumerInput) (*kinesis.DeregisterStreamConsumerOutput, error) {
+			deregistered = aws.ToString(params.ConsumerARN)
+			return &kinesis.DeregisterStreamConsumerOutput{}, nil
+		},
+	}
+
+	c, err := New("myStreamName",
+		WithClient(client),
+		WithStreamConsumer("app", WithStreamConsumerDeregistration(true)),
+	)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Scan(ctx, func(r *Record) error { return nil }); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+	if deregistered != "consumer-arn" {
+		t.Fatalf("deregistered ARN = %q, want %q", deregistered, "consumer-arn")
+	}
+}
@@ -0,0 +1,248 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+const (
+	// Kinesis closes a SubscribeToShard stream after 5 minutes; renewing on
+	// the same cadence keeps a stalled connection from outliving that window.
+	subscriptionRenewInterval = 5 * time.Minute
+	subscribeRetryBaseDelay   = time.Second
+)
+
+type subscribeShardRunner struct {
+	consumer   *Consumer
+	shardID    string
+	fn         ScanFunc
+	lastSeqNum string
+}
+
+func newSubscribeShardRunner(consumer *Consumer, shardID string, fn ScanFunc) *subscribeShardRunner {
+	return &subscribeShardRunner{
+		consumer: consumer,
+		shardID:  shardID,
+		fn:       fn,
+	}
+}
+
+func (r *subscribeShardRunner) run(ctx context.Context) error {
+	lastSeqNum, err := r.consumer.group.GetCheckpoint(r.consumer.streamName, r.shardID)
+	if err != nil {
+		return fmt.Errorf("get checkpoint error: %w", err)
+	}
+	r.lastSeqNum = lastSeqNum
+	position, err := r.consumer.startingPosition(ctx, r.shardID, lastSeqNum)
+	if err != nil {
+		return err
+	}
+
+	r.consumer.logger.Log("[CONSUMER] start subscription:", r.shardID, lastSeqNum)
+	defer func() {
+		r.consumer.logger.Log("[CONSUMER] stop subscription:", r.shardID)
+	}()
+
+	// the subscription ends on Shutdown; an event already received is
+	// processed with ctx
+	fetchCtx, stopFetching := r.consumer.fetchContext(ctx)
+	defer stopFetching()
+
+	retryAttempt := 0
+	for {
+		// a paused shard is not subscribed; the position does not expire
+		if ok, _ := r.consumer.waitWhilePaused(fetchCtx, r.shardID, nil); !ok {
+			return nil
+		}
+
+		stream, err := r.consumer.subscriber.SubscribeToShard(fetchCtx, &kinesis.SubscribeToShardInput{
+			ConsumerARN:      aws.String(r.consumer.consumerARN),
+			ShardId:          aws.String(r.shardID),
+			StartingPosition: position,
+		})
+		if err == nil {
+			var shardEnded, delivered bool
+			position, shardEnded, delivered, err = r.consume(ctx, fetchCtx, stream, position)
+			if recordErr := (*recordProcessingError)(nil); errors.As(err, &recordErr) {
+				// callback and checkpoint errors stop the scan as in polling mode
+				return recordErr.err
+			}
+			if err == nil && shardEnded {
+				return r.consumer.handleShardClosed(r.shardID)
+			}
+			if delivered {
+				retryAttempt = 0
+			}
+		}
+		if fetchCtx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			// subscription expired normally, renew from the continuation point
+			continue
+		}
+
+		r.consumer.logger.Log("[CONSUMER] subscribe to shard error:", r.shardID, err.Error())
+		if isExpiredCheckpointSequenceError(err, aws.ToString(position.SequenceNumber)) {
+			r.consumer.logger.Log("[CONSUMER] checkpoint sequence is expired, falling back to TRIM_HORIZON:", r.shardID, aws.ToString(position.SequenceNumber))
+			position = &types.StartingPosition{Type: types.ShardIteratorTypeTrimHorizon}
+			continue
+		}
+		if !isRetriableSubscribeError(err) {
+			return fmt.Errorf("subscribe to shard error: %w", err)
+		}
+
+		retryAttempt++
+		delay := exponentialDelay(subscribeRetryBaseDelay, getRecordsRetryMaxDelay, retryAttempt)
+		r.consumer.logger.Log("[CONSUMER] retry backoff:", "subscribe to shard", r.shardID, retryAttempt, delay)
+		if !r.consumer.retryWait(fetchCtx, delay) {
+			return nil
+		}
+	}
+}
+
+// consume reads events until the subscription expires, the shard ends, the
+// stream fails or fetchCtx is done. It returns the position to resubscribe
+// from.
+func (r *subscribeShardRunner) consume(ctx, fetchCtx context.Context, stream shardEventStream, position *types.StartingPosition) (*types.StartingPosition, bool, bool, error) {
+	defer stream.Close()
+
+	renewTimer := time.NewTimer(subscriptionRenewInterval)
+	defer renewTimer.Stop()
+
+	delivered := false
+	for {
+		paused, pauseChanged := r.consumer.pauses.state(r.shardID)
+		if paused {
+			// close the subscription; run resubscribes once resumed
+			return position, false, delivered, nil
+		}
+
+		select {
+		case <-fetchCtx.Done():
+			return position, false, delivered, nil
+		case <-pauseChanged:
+		case <-renewTimer.C:
+			return position, false, delivered, nil
+		case event, ok := <-stream.Events():
+			if !ok {
+				return position, false, delivered, stream.Err()
+			}
+			shardEvent, ok := event.(*types.SubscribeToShardEventStreamMemberSubscribeToShardEvent)
+			if !ok {
+				continue
+			}
+			delivered = true
+
+			if err := r.handleEvent(ctx, shardEvent.Value); err != nil {
+				return position, false, delivered, &recordProcessingError{err: err}
+			}
+			if fetchCtx.Err() != nil {
+				return position, false, delivered, nil
+			}
+			if isSubscriptionShardEnded(shardEvent.Value) {
+				r.consumer.logger.Log("[CONSUMER] shard ended with child shards:", r.shardID, childShardIDs(shardEvent.Value.ChildShards))
+				return position, true, delivered, nil
+			}
+			position = &types.StartingPosition{
+				Type:           types.ShardIteratorTypeAfterSequenceNumber,
+				SequenceNumber: shardEvent.Value.ContinuationSequenceNumber,
+			}
+		}
+	}
+}
+
+// handleEvent processes the records pushed in an event. With a memory budget
+// it waits for budget first, which stops reading further events meanwhile.
+func (r *subscribeShardRunner) handleEvent(ctx context.Context, event types.SubscribeToShardEvent) error {
+	lease, ok := r.consumer.memory.acquire(ctx, int64(recordsSize(event.Records)))
+	if !ok {
+		return nil
+	}
+	defer lease.release()
+
+	records, err := r.consumer.normalizeRecords(ctx, r.shardID, event.Records)
+	if err != nil {
+		return err
+	}
+
+	r.lastSeqNum, err = r.consumer.processRecords(ctx, r.shardID, records, event.MillisBehindLatest, lease.bind(r.fn), r.lastSeqNum)
+	return err
+}
+
+// recordProcessingError marks an error from processing delivered records, as
+// opposed to one from the subscription, so it is never retried.
+type recordProcessingError struct {
+	err error
+}
+
+func (e *recordProcessingError) Error() string { return e.err.Error() }
+func (e *recordProcessingError) Unwrap() error { return e.err }
+
+func (c *Consumer) startingPosition(ctx context.Context, shardID, seqNum string) (*types.StartingPosition, error) {
+	if seqNum, _, within := parseCheckpoint(seqNum); within {
+		return &types.StartingPosition{
+			Type:           types.ShardIteratorTypeAtSequenceNumber,
+			SequenceNumber: aws.String(seqNum),
+		}, nil
+	}
+	if seqNum != "" {
+		return &types.StartingPosition{
+			Type:           types.ShardIteratorTypeAfterSequenceNumber,
+			SequenceNumber: aws.String(seqNum),
+		}, nil
+	}
+	trimHorizon, err := c.startsAtTrimHorizon(ctx, shardID)
+	if err != nil {
+		return nil, err
+	}
+	if trimHorizon {
+		return &types.StartingPosition{Type: types.ShardIteratorTypeTrimHorizon}, nil
+	}
+	if c.initialTimestamp != nil {
+		return &types.StartingPosition{
+			Type:      types.ShardIteratorTypeAtTimestamp,
+			Timestamp: c.initialTimestamp,
+		}, nil
+	}
+	return &types.StartingPosition{Type: c.initialShardIteratorType}, nil
+}
+
+// isSubscriptionShardEnded reports whether the event marks the end of a closed
+// shard. Kinesis sends the child shards and no continuation sequence number
+// once the parent has been fully read.
+func isSubscriptionShardEnded(event types.SubscribeToShardEvent) bool {
+	return len(event.ChildShards) > 0 || event.ContinuationSequenceNumber == nil
+}
+
+func childShardIDs(children []types.ChildShard) []string {
+	ids := make([]string, 0, len(children))
+	for _, child := range children {
+		ids = append(ids, aws.ToString(child.ShardId))
+	}
+	return ids
+}
+
+func isRetriableSubscribeError(err error) bool {
+	if isRetriableError(err) {
+		return true
+	}
+	// ResourceInUseException is returned when a previous subscription for the
+	// same shard is still within its 5 second takeover window.
+	if isResourceInUseError(err) {
+		return true
+	}
+	if oe := (*types.LimitExceededException)(nil); errors.As(err, &oe) {
+		return true
+	}
+	if oe := (*types.InternalFailureException)(nil); errors.As(err, &oe) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	store "github.com/harlow/kinesis-consumer/store/memory"
+)
+
+type fakeEventStream struct {
+	events chan types.SubscribeToShardEventStream
+	err    error
+}
+
+func newFakeEventStream(err error, events ...types.SubscribeToShardEvent) *fakeEventStream {
+	s := &fakeEventStream{
+		events: make(chan types.SubscribeToShardEventStream, len(events)),
+		err:    err,
+	}
+	for _, event := range events {
+		s.events <- &types.SubscribeToShardEventStreamMemberSubscribeToShardEvent{Value: event}
+	}
+	close(s.events)
+	return s
+}
+
+func (s *fakeEventStream) Events() <-chan types.SubscribeToShardEventStream { return s.events }
+func (s *fakeEventStream) Close() error                                     { return nil }
+func (s *fakeEventStream) Err() error                                       { return s.err }
+
+type fakeShardSubscriber struct {
+	mu      sync.Mutex
+	inputs  []*kinesis.SubscribeToShardInput
+	streams []func() (shardEventStream, error)
+}
+
+func (f *fakeShardSubscriber) SubscribeToShard(ctx context.Context, params *kinesis.SubscribeToShardInput) (shardEventStream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.inputs = append(f.inputs, params)
+	if len(f.inputs) > len(f.streams) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return f.streams[len(f.inputs)-1]()
+}
+
+func newEnhancedFanOutConsumer(t *testing.T, subscriber shardSubscriber, opts ...Option) *Consumer {
+	t.Helper()
+
+	opts = append([]Option{
+		WithClient(&kinesisClientMock{}),
+		WithEnhancedFanOut("arn:aws:kinesis:us-east-1:123456789012:stream/myStreamName/consumer/app:1"),
+	}, opts...)
+	c, err := New("myStreamName", opts...)
+	if err != nil {
+		t.Fatalf("new consumer error: %v", err)
+	}
+	c.subscriber = subscriber
+	c.retryWait = func(ctx context.Context, d time.Duration) bool { return ctx.Err() == nil }
+	return c
+}
+
+func TestScanShard_EnhancedFanOutDeliversRecordsAndCheckpoints(t *testing.T) {
+	subscriber := &fakeShardSubscriber{
+		streams: []func() (shardEventStream, error){
+			func() (shardEventStream, error) {
+				return newFakeEventStream(nil, types.SubscribeToShardEvent{
+					ContinuationSequenceNumber: aws.String("lastSeqNum"),
+					MillisBehindLatest:         aws.Int64(0),
+					Records:                    records,
+				}), nil
+			},
+		},
+	}
+	cp := store.New()
+	c := newEnhancedFanOutConsumer(t, subscriber, WithStore(cp))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var res string
+	err := c.ScanShard(ctx, "myShard", func(r *Record) error {
+		res += string(r.Data)
+		if aws.ToString(r.SequenceNumber) == "lastSeqNum" {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	if res != "firstDatalastData" {
+		t.Fatalf("callback data = %q, want %q", res, "firstDatalastData")
+	}
+	if val, _ := cp.GetCheckpoint("myStreamName", "myShard"); val != "lastSeqNum" {
+		t.Fatalf("checkpoint = %q, want %q", val, "lastSeqNum")
+	}
+	if got := subscriber.inputs[0].StartingPosition.Type; got != types.ShardIteratorTypeLatest {
+		t.Fatalf("starting position = %s, want %s", got, types.ShardIteratorTypeLatest)
+	}
+}
+
+func TestScanShard_EnhancedFanOutRenewsFromContinuationSequence(t *testing.T) {
+	subscriber := &fakeShardSubscriber{
+		streams: []func() (shardEventStream, error){
+			func() (shardEventStream, error) {
+				return newFakeEventStream(nil, types.SubscribeToShardEvent{
+					ContinuationSequenceNumber: aws.String("continuation-1"),
+					Records:                    records[:1],
+				}), nil
+			},
+			func() (shardEventStream, error) {
+				return newFakeEventStream(nil, types.SubscribeToShardEvent{
+					ContinuationSequenceNumber: aws.String("continuation-2"),
+					Records:                    records[1:],
+				}), nil
+			},
+		},
+	}
+	c := newEnhancedFanOutConsumer(t, subscriber, WithStore(store.New()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := c.ScanShard(ctx, "myShard", func(r *Record) error {
+		if aws.ToString(r.SequenceNumber) == "lastSeqNum" {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	if len(subscriber.inputs) != 2 {
+		t.Fatalf("subscribe calls = %d, want 2", len(subscriber.inputs))
+	}
+	position := subscriber.inputs[1].StartingPosition
+	if position.Type != types.ShardIteratorTypeAfterSequenceNumber || aws.ToString(position.SequenceNumber) != "continuation-1" {
+		t.Fatalf("renewed position = %s/%s, want %s/continuation-1", position.Type, aws.ToString(position.SequenceNumber), types.ShardIteratorTypeAfterSequenceNumber)
+	}
+}
+
+func TestScanShard_EnhancedFanOutStartsAfterCheckpoint(t *testing.T) {
+	subscriber := &fakeShardSubscriber{}
+	cp := store.New()
+	if err := cp.SetCheckpoint("myStreamName", "myShard", "checkpointSeq"); err != nil {
+		t.Fatalf("set checkpoint error: %v", err)
+	}
+	c := newEnhancedFanOutConsumer(t, subscriber, WithStore(cp))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.ScanShard(ctx, "myShard", func(r *Record) error { return nil }); err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	position := subscriber.inputs[0].StartingPosition
+	if position.Type != types.ShardIteratorTypeAfterSequenceNumber || aws.ToString(position.SequenceNumber) != "checkpointSeq" {
+		t.Fatalf("starting position = %s/%s, want AFTER_SEQUENCE_NUMBER/checkpointSeq", position.Type, aws.ToString(position.SequenceNumber))
+	}
+}
+
+func TestScanShard_EnhancedFanOutShardEndCallsShardClosedHandler(t *testing.T) {
+	subscriber := &fakeShardSubscriber{
+		streams: []func() (shardEventStream, error){
+			func() (shardEventStream, error) {
+				return newFakeEventStream(nil, types.SubscribeToShardEvent{
+					Records: records,
+					ChildShards: []types.ChildShard{
+						{ShardId: aws.String("childShard"), ParentShards: []string{"myShard"}},
+					},
+				}), nil
+			},
+		},
+	}
+
+	var closedShard string
+	c := newEnhancedFanOutConsumer(t, subscriber, WithShardClosedHandler(func(streamName, shardID string) error {
+		closedShard = shardID
+		return nil
+	}))
+
+	var count int
+	if err := c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("record count = %d, want 2", count)
+	}
+	if closedShard != "myShard" {
+		t.Fatalf("closed shard = %q, want %q", closedShard, "myShard")
+	}
+}
+
+func TestScanShard_EnhancedFanOutRetriesResourceInUse(t *testing.T) {
+	subscriber := &fakeShardSubscriber{
+		streams: []func() (shardEventStream, error){
+			func() (shardEventStream, error) {
+				return nil, &types.ResourceInUseException{Message: aws.String("subscription in use")}
+			},
+			func() (shardEventStream, error) {
+				return newFakeEventStream(nil, types.SubscribeToShardEvent{Records: records}), nil
+			},
+		},
+	}
+	c := newEnhancedFanOutConsumer(t, subscriber)
+
+	var waits []time.Duration
+	c.retryWait = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return true
+	}
+
+	if err := c.ScanShard(context.Background(), "myShard", func(r *Record) error { return nil }); err != nil {
+		t.Fatalf("scan shard error: %v", err)
+	}
+	if len(waits) != 1 || waits[0] != subscribeRetryBaseDelay {
+		t.Fatalf("retry waits = %v, want [%v]", waits, subscribeRetryBaseDelay)
+	}
+}
+
+func TestScanShard_EnhancedFanOutStreamErrorStopsScan(t *testing.T) {
+	streamErr := errors.New("access denied")
+	subscriber := &fakeShardSubscriber{
+		streams: []func() (shardEventStream, error){
+			func() (shardEventStream, error) {
+				return newFakeEventStream(streamErr), nil
+			},
+		},
+	}
+	c := newEnhancedFanOutConsumer(t, subscriber)
+
+	err := c.ScanShard(context.Background(), "myShard", func(r *Record) error { return nil })
+	if !errors.Is(err, streamErr) {
+		t.Fatalf("scan shard error = %v, want %v", err, streamErr)
+	}
+}
+
+func TestScanShard_EnhancedFanOutCallbackErrorIsNotRetried(t *testing.T) {
+	subscriber := &fakeShardSubscriber{
+		streams: []func() (shardEventStream, error){
+			func() (shardEventStream, error) {
+				return newFakeEventStream(nil, types.SubscribeToShardEvent{
+					ContinuationSequenceNumber: aws.String("lastSeqNum"),
+					Records:                    records,
+				}), nil
+			},
+		},
+	}
+	c := newEnhancedFanOutConsumer(t, subscriber)
+
+	// a callback forwarding to another stream can fail with a retriable Kinesis error
+	callbackErr := fmt.Errorf("forward record: %w", &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")})
+	calls := 0
+	err := c.ScanShard(context.Background(), "myShard", func(r *Record) error {
+		calls++
+		return callbackErr
+	})
+	if !errors.Is(err, callbackErr) {
+		t.Fatalf("scan shard error = %v, want %v", err, callbackErr)
+	}
+	if calls != 1 || len(subscriber.inputs) != 1 {
+		t.Fatalf("callback calls = %d, subscriptions = %d; want 1 and 1", calls, len(subscriber.inputs))
+	}
+}
+
+func TestNew_EnhancedFanOutRequiresStreamingClient(t *testing.T) {
+	_, err := New("myStreamName",
+		WithClient(&pollingOnlyClient{}),
+		WithEnhancedFanOut("arn:aws:kinesis:us-east-1:123456789012:stream/myStreamName/consumer/app:1"),
+	)
+	if err == nil {
+		t.Fatal("expected error for client without SubscribeToShard")
+	}
+}
+
+type pollingOnlyClient struct{}
+
+func (pollingOnlyClient) GetRecords(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (pollingOnlyClient) ListShards(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (pollingOnlyClient) GetShardIterator(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+	return nil, errors.New("not implemented")
+}